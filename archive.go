@@ -0,0 +1,475 @@
+package store
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Archive implements a read-only Store that is backed by a tar or zip
+// archive laid out like a Directory: values are files named after
+// their query-escaped keys with the extension of the Codec, substores
+// are directories, and metadata is kept in ._X.meta files at the top.
+// Tar archives may be compressed with gzip.  The whole archive is read
+// into memory when the Archive is opened.  Mixed works as it does for a
+// Directory, and is needed to read an archive written by ExportArchive
+// from a Store holding values in more than one Codec.
+//
+// Use ExportArchive to write a Store as an archive.
+type Archive struct {
+	storeBase
+	Path string
+	// Format is either tar or zip.
+	Format string
+	Mixed  bool
+	files  map[string][]byte
+	dirs   map[string]struct{}
+	dir    string
+}
+
+func (a *Archive) Type() string {
+	return a.Format
+}
+
+// readTar reads the files in a possibly gzipped tar archive.
+func readTar(r io.Reader, files map[string][]byte, dirs map[string]struct{}) error {
+	br := bufio.NewReader(r)
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = br
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			addArchiveDir(dirs, hdr.Name)
+		case tar.TypeReg:
+			buf, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			addArchiveFile(files, dirs, hdr.Name, buf)
+		}
+	}
+}
+
+// readZip reads the files in a zip archive.
+func readZip(name string, files map[string][]byte, dirs map[string]struct{}) error {
+	zr, err := zip.OpenReader(name)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			addArchiveDir(dirs, f.Name)
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+		addArchiveFile(files, dirs, f.Name, buf)
+	}
+	return nil
+}
+
+func cleanArchiveName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func addArchiveDir(dirs map[string]struct{}, name string) {
+	for name = cleanArchiveName(name); name != "" && name != "."; name = path.Dir(name) {
+		dirs[name] = struct{}{}
+	}
+}
+
+func addArchiveFile(files map[string][]byte, dirs map[string]struct{}, name string, buf []byte) {
+	name = cleanArchiveName(name)
+	files[name] = buf
+	addArchiveDir(dirs, path.Dir(name))
+}
+
+func (a *Archive) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	a.Codec = codec
+	if a.files == nil {
+		if a.Path == "" {
+			return fmt.Errorf("Cannot read data from ''")
+		}
+		a.files, a.dirs = map[string][]byte{}, map[string]struct{}{}
+		switch a.Format {
+		case "tar":
+			f, err := os.Open(a.Path)
+			if err != nil {
+				return err
+			}
+			err = readTar(f, a.files, a.dirs)
+			f.Close()
+			if err != nil {
+				return fmt.Errorf("Invalid tar archive %s: %v", a.Path, err)
+			}
+		case "zip":
+			if err := readZip(a.Path, a.files, a.dirs); err != nil {
+				return fmt.Errorf("Invalid zip archive %s: %v", a.Path, err)
+			}
+		default:
+			return fmt.Errorf("Unknown archive format %s", a.Format)
+		}
+		a.closer = func() {
+			a.files, a.dirs = nil, nil
+		}
+	}
+	a.opened = true
+	a.readOnly = true
+	subs := []string{}
+	for dir := range a.dirs {
+		if path.Dir(dir) != a.treeDir() {
+			continue
+		}
+		if name, err := url.QueryUnescape(path.Base(dir)); err == nil {
+			subs = append(subs, name)
+		}
+	}
+	for _, name := range subs {
+		res := &Archive{Path: a.Path, Format: a.Format, Mixed: a.Mixed, files: a.files, dirs: a.dirs, dir: a.pathOf(name)}
+		if err := res.Open(a.Codec); err != nil {
+			return err
+		}
+		addSub(a, res, name)
+	}
+	md := a.MetaData()
+	if n, ok := md["Name"]; ok {
+		a.name = n
+	}
+	return nil
+}
+
+// treeDir returns the directory in the archive the values of a are
+// in, as path.Dir would return it for their paths.
+func (a *Archive) treeDir() string {
+	if a.dir == "" {
+		return "."
+	}
+	return a.dir
+}
+
+func (a *Archive) pathOf(name string) string {
+	return path.Join(a.dir, url.QueryEscape(name))
+}
+
+// codecs returns the Codecs the Archive reads, indexed by file
+// extension.
+func (a *Archive) codecs() map[string]Codec {
+	if !a.Mixed {
+		return map[string]Codec{a.Ext(): a.Codec}
+	}
+	res := codecsByExt()
+	res[a.Ext()] = a.Codec
+	return res
+}
+
+// locate returns the name of the file key is stored in and the Codec
+// for it.
+func (a *Archive) locate(key string) (string, Codec, error) {
+	fileName, codec := a.pathOf(key+a.Ext()), a.Codec
+	if !a.Mixed {
+		return fileName, codec, nil
+	}
+	found := false
+	for ext, c := range a.codecs() {
+		candidate := a.pathOf(key + ext)
+		if _, ok := a.files[candidate]; !ok {
+			continue
+		}
+		if found {
+			return "", nil, DuplicateKey(path.Join(a.Path, a.pathOf(key)))
+		}
+		fileName, codec, found = candidate, c, true
+	}
+	return fileName, codec, nil
+}
+
+func (a *Archive) codecOf(key string) Codec {
+	if _, codec, err := a.locate(key); err == nil {
+		return codec
+	}
+	return a.Codec
+}
+
+func (a *Archive) MakeSub(name string) (Store, error) {
+	a.panicIfClosed()
+	if res := a.GetSub(name); res != nil {
+		return res, nil
+	}
+	return nil, UnWritable(name)
+}
+
+func (a *Archive) Keys() ([]string, error) {
+	a.panicIfClosed()
+	codecs := a.codecs()
+	seen := map[string]struct{}{}
+	res := []string{}
+	for name := range a.files {
+		if path.Dir(name) != a.treeDir() {
+			continue
+		}
+		base := path.Base(name)
+		ext := path.Ext(base)
+		if _, ok := codecs[ext]; !ok || strings.HasPrefix(base, ".") {
+			continue
+		}
+		key, err := url.QueryUnescape(strings.TrimSuffix(base, ext))
+		if err != nil {
+			continue
+		}
+		if _, ok := seen[key]; ok {
+			return nil, DuplicateKey(path.Join(a.Path, a.pathOf(key)))
+		}
+		seen[key] = struct{}{}
+		res = append(res, key)
+	}
+	return res, nil
+}
+
+func (a *Archive) LoadRaw(key string) ([]byte, error) {
+	a.panicIfClosed()
+	fileName, _, err := a.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	buf, ok := a.files[fileName]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte{}, buf...), nil
+}
+
+func (a *Archive) Load(key string, val interface{}) error {
+	a.panicIfClosed()
+	fileName, codec, err := a.locate(key)
+	if err != nil {
+		return err
+	}
+	buf, ok := a.files[fileName]
+	if !ok {
+		return os.ErrNotExist
+	}
+	if err := codec.Decode(buf, val); err != nil {
+		return decodeError(path.Join(a.Path, fileName), key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(a.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := a.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (a *Archive) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := a.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (a *Archive) Save(key string, val interface{}) error {
+	a.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (a *Archive) SaveRaw(key string, buf []byte) error {
+	a.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (a *Archive) SaveStream(key string, r io.Reader) error {
+	a.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (a *Archive) Remove(key string) error {
+	a.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (a *Archive) MetaData() map[string]string {
+	if a.parentStore != nil {
+		return a.parentStore.(*Archive).MetaData()
+	}
+	res := map[string]string{}
+	for name, buf := range a.files {
+		if strings.Contains(name, "/") {
+			continue
+		}
+		k, ok := metaKey(name)
+		if !ok {
+			continue
+		}
+		if val := strings.TrimSpace(string(buf)); val != "" {
+			res[k] = val
+		}
+	}
+	return res
+}
+
+func (a *Archive) SetMetaData(vals map[string]string) error {
+	return UnWritable("metadata")
+}
+
+// archiveWriter writes files and directories to a tar or zip archive.
+type archiveWriter interface {
+	dir(name string) error
+	file(name string, buf []byte) error
+	Close() error
+}
+
+type tarArchiveWriter struct {
+	*tar.Writer
+	gz *gzip.Writer
+}
+
+func (t *tarArchiveWriter) dir(name string) error {
+	return t.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: name + "/", Mode: 0755})
+}
+
+func (t *tarArchiveWriter) file(name string, buf []byte) error {
+	err := t.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(buf))})
+	if err == nil {
+		_, err = t.Write(buf)
+	}
+	return err
+}
+
+func (t *tarArchiveWriter) Close() error {
+	err := t.Writer.Close()
+	if t.gz != nil {
+		if gzErr := t.gz.Close(); err == nil {
+			err = gzErr
+		}
+	}
+	return err
+}
+
+type zipArchiveWriter struct {
+	*zip.Writer
+}
+
+func (z *zipArchiveWriter) dir(name string) error {
+	_, err := z.Create(name + "/")
+	return err
+}
+
+func (z *zipArchiveWriter) file(name string, buf []byte) error {
+	w, err := z.Create(name)
+	if err == nil {
+		_, err = w.Write(buf)
+	}
+	return err
+}
+
+// ExportArchive writes src and all of its substores to w as an
+// archive that an Archive can read.  format is tar, tgz, or zip.
+// Values are written in the Codec they are stored with, so an archive
+// of a Store holding values in several Codecs must be read with Mixed
+// set.  The archive is the same for the same contents, so that it can
+// be checksummed.
+func ExportArchive(w io.Writer, format string, src Store) error {
+	var aw archiveWriter
+	switch format {
+	case "tar":
+		aw = &tarArchiveWriter{Writer: tar.NewWriter(w)}
+	case "tgz", "tar.gz":
+		gz := gzip.NewWriter(w)
+		aw = &tarArchiveWriter{Writer: tar.NewWriter(gz), gz: gz}
+	case "zip":
+		aw = &zipArchiveWriter{Writer: zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("Unknown archive format %s", format)
+	}
+	if ms, ok := src.(MetaSaver); ok {
+		md := ms.MetaData()
+		keys := make([]string, 0, len(md))
+		for k := range md {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if err := aw.file(metaFile(k), []byte(md[k])); err != nil {
+				return err
+			}
+		}
+	}
+	if err := exportStore(aw, "", src); err != nil {
+		return err
+	}
+	return aw.Close()
+}
+
+func exportStore(aw archiveWriter, dir string, src Store) error {
+	keys, err := src.Keys()
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		buf, codec, err := encodedValue(src, key)
+		if err != nil {
+			return err
+		}
+		if err := aw.file(path.Join(dir, url.QueryEscape(key)+codec.Ext()), buf); err != nil {
+			return err
+		}
+	}
+	subs := src.Subs()
+	names := make([]string, 0, len(subs))
+	for name := range subs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		subDir := path.Join(dir, url.QueryEscape(name))
+		if err := aw.dir(subDir); err != nil {
+			return err
+		}
+		if err := exportStore(aw, subDir, subs[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchive(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-archive-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dir, err := Open("directory:" + filepath.Join(tmpDir, "src") + "?mixed=true")
+	if err != nil {
+		t.Fatalf("Failed to open directory store: %v", err)
+	}
+	defer dir.Close()
+	dir.(MetaSaver).SetMetaData(map[string]string{"Name": "bundle", "Version": "1.0"})
+	dir.Save("a/b", &TestVal{Name: "a/b", Val: "top"})
+	sub, _ := dir.MakeSub("sub")
+	sub.Save("c", &TestVal{Name: "c", Val: "sub"})
+	ioutil.WriteFile(filepath.Join(tmpDir, "src", "sub", "d.yaml"), []byte("Name: d\nVal: yaml\n"), 0644)
+	dir.MakeSub("empty")
+
+	for _, format := range []string{"tar", "tgz", "zip"} {
+		buf := &bytes.Buffer{}
+		if err := ExportArchive(buf, format, dir); err != nil {
+			t.Fatalf("Failed to export %s: %v", format, err)
+		}
+		again := &bytes.Buffer{}
+		ExportArchive(again, format, dir)
+		if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+			t.Errorf("Exporting %s twice gave different archives", format)
+		}
+		name := filepath.Join(tmpDir, "bundle."+format)
+		if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+			t.Fatalf("Failed to write archive: %v", err)
+		}
+		scheme := format
+		if format == "tgz" {
+			scheme = "tar"
+		}
+		plain, err := Open(scheme + ":" + name)
+		if err != nil {
+			t.Fatalf("Failed to open %s archive: %v", format, err)
+		}
+		if keys, _ := plain.GetSub("sub").Keys(); len(keys) != 1 {
+			t.Errorf("%s: expected only c without mixed, got keys %v", format, keys)
+		}
+		plain.Close()
+		s, err := Open(scheme + ":" + name + "?mixed=true")
+		if err != nil {
+			t.Fatalf("Failed to open %s archive: %v", format, err)
+		}
+		if s.Name() != "bundle" || s.(MetaSaver).MetaData()["Version"] != "1.0" {
+			t.Errorf("%s: metadata was not exported", format)
+		}
+		if !s.ReadOnly() {
+			t.Errorf("%s: expected archive to be read-only", format)
+		}
+		val := &TestVal{}
+		if err := s.Load("a/b", val); err != nil || val.Val != "top" {
+			t.Errorf("%s: failed to load a/b: %v, %v", format, val, err)
+		}
+		if s.GetSub("sub") == nil || s.GetSub("empty") == nil {
+			t.Fatalf("%s: substores were not exported", format)
+		}
+		if err := s.GetSub("sub").Load("c", val); err != nil || val.Val != "sub" {
+			t.Errorf("%s: failed to load sub/c: %v, %v", format, val, err)
+		}
+		if err := s.GetSub("sub").Load("d", val); err != nil || val.Val != "yaml" {
+			t.Errorf("%s: failed to load sub/d: %v, %v", format, val, err)
+		}
+		if buf, err := s.(RawStore).LoadRaw("a/b"); err == nil && len(buf) > 0 {
+			buf[0] = 'X'
+			if again, _ := s.(RawStore).LoadRaw("a/b"); again[0] == 'X' {
+				t.Errorf("%s: changing raw bytes changed the archive", format)
+			}
+		} else {
+			t.Errorf("%s: failed to load raw a/b: %v", format, err)
+		}
+		if err := s.Save("a/b", val); err != UnWritable("a/b") {
+			t.Errorf("%s: expected saving to fail, got %v", format, err)
+		}
+		mem, _ := Open("memory:///")
+		if err := Copy(mem, s); err != nil {
+			t.Errorf("%s: failed to copy archive: %v", format, err)
+		} else if keys, _ := mem.GetSub("sub").Keys(); len(keys) != 2 {
+			t.Errorf("%s: expected sub to be copied, got keys %v", format, keys)
+		}
+		s.Close()
+	}
+}
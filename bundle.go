@@ -0,0 +1,526 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Bundle implements a read-only Store that is backed by a single
+// immutable file in a compact format that ExportBundle writes.  The file
+// is mapped into memory where the platform allows it, and opening it
+// only reads its trailer and the list of substores, so a Bundle with
+// many keys opens as fast as one with a few.  Keys are found with a
+// binary search of the index, and values are decoded straight from the
+// mapped file.
+//
+// A bundle file is laid out as:
+//
+//	header:  the magic "DRSTBNDL", a version, and 4 reserved bytes
+//	data:    the names of substores, the keys, and their values
+//	info:    JSON holding the codec extensions and the metadata
+//	stores:  a 24 byte record for each Store, the top-level one first
+//	entries: a 32 byte record for each key, sorted by key within a Store
+//	trailer: the offsets of the above, a SHA-256 checksum of everything
+//	         before the trailer, and the magic again
+//
+// All integers are little-endian.  The checksum is only verified when
+// Verify is set, as that reads the whole file.
+type Bundle struct {
+	storeBase
+	Path string
+	// Verify makes Open check the checksum of the file.
+	Verify bool
+	file   *bundleFile
+	first  uint32
+	count  uint32
+}
+
+const (
+	bundleMagic      = "DRSTBNDL"
+	bundleVersion    = 1
+	bundleHeaderLen  = 16
+	bundleStoreLen   = 24
+	bundleEntryLen   = 32
+	bundleTrailerLen = 80
+	bundleNoParent   = ^uint32(0)
+)
+
+// bundleInfo is the JSON part of a bundle file.
+type bundleInfo struct {
+	Codecs   []string
+	MetaData map[string]string `json:",omitempty"`
+}
+
+// bundleFile is the file a Bundle and all of its substores share.  mux
+// keeps the file from being unmapped while it is being read, and data
+// is nil once it has been.
+type bundleFile struct {
+	mux     sync.RWMutex
+	data    []byte
+	entries []byte
+	codecs  []Codec
+	meta    map[string]string
+}
+
+func (b *Bundle) Type() string {
+	return "bundle"
+}
+
+func readBundleFile(path string) ([]byte, func(), error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	if fi.Size() < bundleHeaderLen+bundleTrailerLen {
+		return nil, nil, fmt.Errorf("Invalid bundle %s: too short", path)
+	}
+	return mapBundle(f, fi.Size())
+}
+
+func (b *Bundle) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	b.Codec = codec
+	if b.file == nil {
+		if b.Path == "" {
+			return fmt.Errorf("Cannot read data from ''")
+		}
+		data, unmap, err := readBundleFile(b.Path)
+		if err != nil {
+			return err
+		}
+		file, stores, err := parseBundle(data, codec, b.Verify)
+		if err != nil {
+			unmap()
+			return fmt.Errorf("Invalid bundle %s: %v", b.Path, err)
+		}
+		b.file = file
+		b.closer = func() {
+			file.mux.Lock()
+			defer file.mux.Unlock()
+			if file.data != nil {
+				file.data, file.entries = nil, nil
+				unmap()
+			}
+		}
+		if err := b.openStores(stores); err != nil {
+			b.closer()
+			return fmt.Errorf("Invalid bundle %s: %v", b.Path, err)
+		}
+	}
+	b.opened = true
+	b.readOnly = true
+	if n, ok := b.file.meta["Name"]; ok {
+		b.name = n
+	}
+	return nil
+}
+
+// parseBundle checks the header and trailer of a bundle file, and
+// returns it along with its table of Stores.
+func parseBundle(data []byte, codec Codec, verify bool) (*bundleFile, []byte, error) {
+	le := binary.LittleEndian
+	if string(data[:8]) != bundleMagic || string(data[len(data)-8:]) != bundleMagic {
+		return nil, nil, fmt.Errorf("not a bundle")
+	}
+	if v := le.Uint32(data[8:]); v != bundleVersion {
+		return nil, nil, fmt.Errorf("unknown version %d", v)
+	}
+	end := uint64(len(data) - bundleTrailerLen)
+	trailer := data[end:]
+	if verify {
+		sum := sha256.Sum256(data[:end])
+		if !bytes.Equal(sum[:], trailer[40:72]) {
+			return nil, nil, fmt.Errorf("checksum mismatch")
+		}
+	}
+	infoOff, infoLen := le.Uint64(trailer), uint64(le.Uint32(trailer[8:]))
+	storeCount := uint64(le.Uint32(trailer[12:]))
+	storesOff, entriesOff := le.Uint64(trailer[16:]), le.Uint64(trailer[24:])
+	entryCount := le.Uint64(trailer[32:])
+	stores, ok := bundleSlice(data[:end], storesOff, storeCount*bundleStoreLen)
+	if !ok || storeCount == 0 {
+		return nil, nil, fmt.Errorf("bad store table")
+	}
+	entries, ok := bundleSlice(data[:end], entriesOff, entryCount*bundleEntryLen)
+	if !ok {
+		return nil, nil, fmt.Errorf("bad index")
+	}
+	infoBuf, ok := bundleSlice(data[:end], infoOff, infoLen)
+	if !ok {
+		return nil, nil, fmt.Errorf("bad info")
+	}
+	info := bundleInfo{}
+	if err := json.Unmarshal(infoBuf, &info); err != nil {
+		return nil, nil, fmt.Errorf("bad info: %v", err)
+	}
+	res := &bundleFile{data: data[:end], entries: entries, meta: info.MetaData}
+	byExt := codecsByExt()
+	for _, ext := range info.Codecs {
+		c := byExt[ext]
+		if ext == codec.Ext() {
+			c = codec
+		}
+		if c == nil {
+			return nil, nil, fmt.Errorf("no codec for %s", ext)
+		}
+		res.codecs = append(res.codecs, c)
+	}
+	return res, stores, nil
+}
+
+// bundleSlice returns the size bytes of data at off, or false if they
+// are not all in data.
+func bundleSlice(data []byte, off, size uint64) ([]byte, bool) {
+	if off > uint64(len(data)) || size > uint64(len(data))-off {
+		return nil, false
+	}
+	return data[off : off+size], true
+}
+
+// openStores opens the substores in the table of Stores, which lists
+// every Store after its parent.
+func (b *Bundle) openStores(table []byte) error {
+	le := binary.LittleEndian
+	stores := []*Bundle{}
+	entryCount := uint64(len(b.file.entries) / bundleEntryLen)
+	for i := 0; i < len(table); i += bundleStoreLen {
+		rec := table[i : i+bundleStoreLen]
+		s := b
+		if i > 0 {
+			s = &Bundle{Path: b.Path, file: b.file}
+		}
+		s.first, s.count = le.Uint32(rec[16:]), le.Uint32(rec[20:])
+		if uint64(s.first)+uint64(s.count) > entryCount {
+			return fmt.Errorf("bad store table")
+		}
+		parent := le.Uint32(rec[12:])
+		if i == 0 {
+			if parent != bundleNoParent {
+				return fmt.Errorf("bad store table")
+			}
+			stores = append(stores, s)
+			continue
+		}
+		name, ok := bundleSlice(b.file.data, le.Uint64(rec), uint64(le.Uint32(rec[8:])))
+		if !ok || uint64(parent) >= uint64(len(stores)) {
+			return fmt.Errorf("bad store table")
+		}
+		if err := s.Open(b.Codec); err != nil {
+			return err
+		}
+		addSub(stores[parent], s, string(name))
+		stores = append(stores, s)
+	}
+	return nil
+}
+
+// acquire read-locks the file of b so that it stays mapped until it is
+// released with RUnlock, and panics if it has already been unmapped.
+func (b *Bundle) acquire() *bundleFile {
+	f := b.file
+	f.mux.RLock()
+	if f.data == nil {
+		f.mux.RUnlock()
+		panic("Operation on closed store")
+	}
+	return f
+}
+
+// entry returns the key, value, and Codec of the i'th key in b.  The
+// file of b must be acquired.
+func (b *Bundle) entry(i uint32) ([]byte, []byte, Codec, error) {
+	le := binary.LittleEndian
+	rec := b.file.entries[uint64(b.first+i)*bundleEntryLen:]
+	key, ok := bundleSlice(b.file.data, le.Uint64(rec), uint64(le.Uint32(rec[8:])))
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("Invalid bundle %s: bad key", b.Path)
+	}
+	val, ok := bundleSlice(b.file.data, le.Uint64(rec[16:]), le.Uint64(rec[24:]))
+	codec := le.Uint32(rec[12:])
+	if !ok || codec >= uint32(len(b.file.codecs)) {
+		return nil, nil, nil, fmt.Errorf("Invalid bundle %s: bad value for %s", b.Path, key)
+	}
+	return key, val, b.file.codecs[codec], nil
+}
+
+// find returns the value of key and the Codec it is encoded with.  The
+// file of b must be acquired.
+func (b *Bundle) find(key string) ([]byte, Codec, error) {
+	var err error
+	i := sort.Search(int(b.count), func(i int) bool {
+		k, _, _, kerr := b.entry(uint32(i))
+		if kerr != nil {
+			err = kerr
+			return true
+		}
+		return string(k) >= key
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if i == int(b.count) {
+		return nil, nil, os.ErrNotExist
+	}
+	k, val, codec, err := b.entry(uint32(i))
+	if err != nil {
+		return nil, nil, err
+	}
+	if string(k) != key {
+		return nil, nil, os.ErrNotExist
+	}
+	return val, codec, nil
+}
+
+func (b *Bundle) codecOf(key string) Codec {
+	f := b.acquire()
+	defer f.mux.RUnlock()
+	if _, codec, err := b.find(key); err == nil {
+		return codec
+	}
+	return b.Codec
+}
+
+func (b *Bundle) MakeSub(name string) (Store, error) {
+	b.panicIfClosed()
+	if res := b.GetSub(name); res != nil {
+		return res, nil
+	}
+	return nil, UnWritable(name)
+}
+
+func (b *Bundle) Keys() ([]string, error) {
+	b.panicIfClosed()
+	f := b.acquire()
+	defer f.mux.RUnlock()
+	res := make([]string, 0, b.count)
+	for i := uint32(0); i < b.count; i++ {
+		key, _, _, err := b.entry(i)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, string(key))
+	}
+	return res, nil
+}
+
+func (b *Bundle) LoadRaw(key string) ([]byte, error) {
+	b.panicIfClosed()
+	f := b.acquire()
+	defer f.mux.RUnlock()
+	val, _, err := b.find(key)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{}, val...), nil
+}
+
+func (b *Bundle) Load(key string, val interface{}) error {
+	b.panicIfClosed()
+	if err := b.decode(key, val); err != nil {
+		return err
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(b.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := b.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+// decode decodes the value of key into val while the file of b is
+// acquired, as the value is decoded straight from it.
+func (b *Bundle) decode(key string, val interface{}) error {
+	f := b.acquire()
+	defer f.mux.RUnlock()
+	buf, codec, err := b.find(key)
+	if err != nil {
+		return err
+	}
+	if err := codec.Decode(buf, val); err != nil {
+		return decodeError(b.Path, key, err)
+	}
+	return nil
+}
+
+func (b *Bundle) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := b.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (b *Bundle) Save(key string, val interface{}) error {
+	b.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (b *Bundle) SaveRaw(key string, buf []byte) error {
+	b.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (b *Bundle) SaveStream(key string, r io.Reader) error {
+	b.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (b *Bundle) Remove(key string) error {
+	b.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (b *Bundle) MetaData() map[string]string {
+	if b.parentStore != nil {
+		return b.parentStore.(*Bundle).MetaData()
+	}
+	res := map[string]string{}
+	if b.file != nil {
+		for k, v := range b.file.meta {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func (b *Bundle) SetMetaData(vals map[string]string) error {
+	return UnWritable("metadata")
+}
+
+// bundleWriter writes a bundle file, keeping track of where it is and
+// of the checksum of what it has written.
+type bundleWriter struct {
+	w   io.Writer
+	sum hash.Hash
+	off uint64
+	err error
+}
+
+// write writes buf and returns the offset it was written at.
+func (bw *bundleWriter) write(buf []byte) uint64 {
+	off := bw.off
+	if bw.err == nil {
+		_, bw.err = bw.w.Write(buf)
+		bw.sum.Write(buf)
+		bw.off += uint64(len(buf))
+	}
+	return off
+}
+
+type bundleBuilder struct {
+	*bundleWriter
+	stores  []byte
+	entries []byte
+	codecs  []string
+}
+
+// ExportBundle writes src and all of its substores to w as a bundle
+// that a Bundle can read.  Values are written in the Codec they are
+// stored with, and the bundle is the same for the same contents.
+func ExportBundle(w io.Writer, src Store) error {
+	sum := sha256.New()
+	bb := &bundleBuilder{bundleWriter: &bundleWriter{w: w, sum: sum}}
+	le := binary.LittleEndian
+	header := make([]byte, bundleHeaderLen)
+	copy(header, bundleMagic)
+	le.PutUint32(header[8:], bundleVersion)
+	bb.write(header)
+	if err := bb.store(src, "", bundleNoParent); err != nil {
+		return err
+	}
+	info := bundleInfo{Codecs: bb.codecs}
+	if ms, ok := src.(MetaSaver); ok {
+		if md := ms.MetaData(); len(md) > 0 {
+			info.MetaData = md
+		}
+	}
+	buf, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	trailer := make([]byte, bundleTrailerLen)
+	le.PutUint64(trailer, bb.write(buf))
+	le.PutUint32(trailer[8:], uint32(len(buf)))
+	le.PutUint32(trailer[12:], uint32(len(bb.stores)/bundleStoreLen))
+	le.PutUint64(trailer[16:], bb.write(bb.stores))
+	le.PutUint64(trailer[24:], bb.write(bb.entries))
+	le.PutUint64(trailer[32:], uint64(len(bb.entries)/bundleEntryLen))
+	copy(trailer[40:], sum.Sum(nil))
+	copy(trailer[72:], bundleMagic)
+	if bb.err == nil {
+		_, bb.err = w.Write(trailer)
+	}
+	return bb.err
+}
+
+func (bb *bundleBuilder) codec(c Codec) uint32 {
+	for i, ext := range bb.codecs {
+		if ext == c.Ext() {
+			return uint32(i)
+		}
+	}
+	bb.codecs = append(bb.codecs, c.Ext())
+	return uint32(len(bb.codecs) - 1)
+}
+
+func (bb *bundleBuilder) store(src Store, name string, parent uint32) error {
+	le := binary.LittleEndian
+	keys, err := src.Keys()
+	if err != nil {
+		return err
+	}
+	sort.Strings(keys)
+	rec := make([]byte, bundleStoreLen)
+	le.PutUint64(rec, bb.write([]byte(name)))
+	le.PutUint32(rec[8:], uint32(len(name)))
+	le.PutUint32(rec[12:], parent)
+	le.PutUint32(rec[16:], uint32(len(bb.entries)/bundleEntryLen))
+	le.PutUint32(rec[20:], uint32(len(keys)))
+	self := uint32(len(bb.stores) / bundleStoreLen)
+	bb.stores = append(bb.stores, rec...)
+	for _, key := range keys {
+		buf, codec, err := encodedValue(src, key)
+		if err != nil {
+			return err
+		}
+		entry := make([]byte, bundleEntryLen)
+		le.PutUint64(entry, bb.write([]byte(key)))
+		le.PutUint32(entry[8:], uint32(len(key)))
+		le.PutUint32(entry[12:], bb.codec(codec))
+		le.PutUint64(entry[16:], bb.write(buf))
+		le.PutUint64(entry[24:], uint64(len(buf)))
+		bb.entries = append(bb.entries, entry...)
+	}
+	subs := src.Subs()
+	names := make([]string, 0, len(subs))
+	for n := range subs {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		if err := bb.store(subs[n], n, self); err != nil {
+			return err
+		}
+	}
+	return bb.err
+}
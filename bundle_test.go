@@ -0,0 +1,118 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundle(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-bundle-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	dir, err := Open("directory:" + filepath.Join(tmpDir, "src") + "?mixed=true")
+	if err != nil {
+		t.Fatalf("Failed to open directory store: %v", err)
+	}
+	defer dir.Close()
+	dir.(MetaSaver).SetMetaData(map[string]string{"Name": "bundle", "Version": "1.0"})
+	for i := 0; i < 100; i++ {
+		dir.Save(fmt.Sprintf("key%03d", i), &TestVal{Name: "key", Val: fmt.Sprint(i)})
+	}
+	sub, _ := dir.MakeSub("sub")
+	sub.Save("c", &TestVal{Name: "c", Val: "sub"})
+	ioutil.WriteFile(filepath.Join(tmpDir, "src", "sub", "d.yaml"), []byte("Name: d\nVal: yaml\n"), 0644)
+	deeper, _ := sub.MakeSub("deeper")
+	deeper.Save("e", &TestVal{Name: "e", Val: "deeper"})
+	dir.MakeSub("empty")
+
+	buf := &bytes.Buffer{}
+	if err := ExportBundle(buf, dir); err != nil {
+		t.Fatalf("Failed to export bundle: %v", err)
+	}
+	again := &bytes.Buffer{}
+	ExportBundle(again, dir)
+	if !bytes.Equal(buf.Bytes(), again.Bytes()) {
+		t.Errorf("Exporting twice gave different bundles")
+	}
+	name := filepath.Join(tmpDir, "test.bundle")
+	if err := ioutil.WriteFile(name, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	s, err := Open("bundle:" + name + "?verify=true")
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "bundle" || s.(MetaSaver).MetaData()["Version"] != "1.0" {
+		t.Errorf("Metadata was not exported")
+	}
+	if !s.ReadOnly() {
+		t.Errorf("Expected bundle to be read-only")
+	}
+	if keys, _ := s.Keys(); len(keys) != 100 {
+		t.Errorf("Expected 100 keys, got %d", len(keys))
+	}
+	val := &TestVal{}
+	for _, i := range []int{0, 42, 99} {
+		if err := s.Load(fmt.Sprintf("key%03d", i), val); err != nil || val.Val != fmt.Sprint(i) {
+			t.Errorf("Failed to load key%03d: %v, %v", i, val, err)
+		}
+	}
+	if err := s.Load("key100", val); !os.IsNotExist(err) {
+		t.Errorf("Expected missing key to not exist, got %v", err)
+	}
+	if s.GetSub("sub") == nil || s.GetSub("empty") == nil || s.GetSub("sub").GetSub("deeper") == nil {
+		t.Fatalf("Substores were not exported")
+	}
+	if err := s.GetSub("sub").Load("d", val); err != nil || val.Val != "yaml" {
+		t.Errorf("Failed to load sub/d: %v, %v", val, err)
+	}
+	if err := s.GetSub("sub").GetSub("deeper").Load("e", val); err != nil || val.Val != "deeper" {
+		t.Errorf("Failed to load sub/deeper/e: %v, %v", val, err)
+	}
+	if err := s.Save("key000", val); err != UnWritable("key000") {
+		t.Errorf("Expected saving to fail, got %v", err)
+	}
+	mem, _ := Open("memory:///")
+	if err := Copy(mem, s); err != nil {
+		t.Errorf("Failed to copy bundle: %v", err)
+	} else if keys, _ := mem.GetSub("sub").Keys(); len(keys) != 2 {
+		t.Errorf("Expected sub to be copied, got keys %v", keys)
+	}
+
+	closing, err := Open("bundle:" + name)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	grandchild := closing.GetSub("sub").GetSub("deeper")
+	closing.Close()
+	if !grandchild.Closed() {
+		t.Errorf("Expected closing the bundle to close sub/deeper")
+	}
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("Expected loading from a closed substore to panic")
+			}
+		}()
+		grandchild.Load("e", val)
+	}()
+
+	name = filepath.Join(tmpDir, "bad.bundle")
+	corrupt := append([]byte{}, buf.Bytes()...)
+	corrupt[100] ^= 0xff
+	ioutil.WriteFile(name, corrupt, 0644)
+	if _, err := Open("bundle:" + name + "?verify=true"); err == nil {
+		t.Errorf("Expected corrupt bundle to fail verification")
+	}
+	ioutil.WriteFile(name, []byte("not a bundle"), 0644)
+	if _, err := Open("bundle:" + name); err == nil {
+		t.Errorf("Expected opening a non-bundle to fail")
+	}
+}
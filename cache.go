@@ -0,0 +1,397 @@
+package store
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Event describes a change made to a Store by something other than
+// the caller.  An empty Key means that any key in the Store may have
+// changed.
+type Event struct {
+	Key string
+	Op  Op
+}
+
+// OpLost is the Op of the last Event a Watcher sends when its watch
+// ends without being cancelled, such as when the connection to the
+// server is lost.  Anything may have changed, and no further changes
+// will be reported.
+const OpLost Op = "lost"
+
+// Watcher is implemented by Stores that can report changes made to
+// them by other clients.  Watch arranges for fn to be called for each
+// change until the returned cancel function is called, or until fn is
+// called with an Event whose Op is OpLost.
+type Watcher interface {
+	Store
+	Watch(fn func(Event)) (cancel func(), err error)
+}
+
+// CacheStats are the counters a Cache keeps.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+type cacheKey struct {
+	store Store
+	key   string
+}
+
+type cacheEntry struct {
+	cacheKey
+	buf     []byte
+	codec   Codec
+	expires time.Time
+}
+
+type cachedKeys struct {
+	keys    []string
+	expires time.Time
+}
+
+// Cache is a read-through cache of encoded values and key lists that
+// is used as a Middleware.  Use WithCache to wrap a Store in one.
+//
+// Values are cached as the bytes the underlying Store holds, so every
+// Load from the cache decodes a fresh copy into whatever type the
+// caller asks for.  When the underlying Store is a RawStore, a miss
+// reads those bytes with LoadRaw, bypassing any Middleware that Store
+// was wrapped with.  Size bounds the number of values held
+// across the Store and all of its substores, with the least recently
+// used value evicted first.  Values and key lists older than TTL are
+// refetched.  A zero Size or TTL means no bound.
+//
+// Saves and removes made through the Cache invalidate what it holds
+// for the changed key, and if the underlying Store is a Watcher,
+// changes reported by it invalidate the cache as well.  Changes made
+// some other way, such as by another process sharing a Consul or Redis
+// Store, are not seen until TTL runs out, so set a TTL unless the
+// underlying Store is a Watcher or nothing else writes to it.  If the
+// watch on a Watcher is lost, nothing is cached for it until the Cache
+// watches it again, which it tries to do on the next Load or Keys.
+type Cache struct {
+	Size int
+	TTL  time.Duration
+
+	mux      sync.Mutex
+	lru      *list.List
+	entries  map[cacheKey]*list.Element
+	keys     map[Store]*cachedKeys
+	watching map[Store]func()
+	stats    CacheStats
+	// gen counts invalidations, so that a value loaded while its key
+	// was being invalidated is not put in the cache.
+	gen uint64
+}
+
+// WithCache returns s wrapped in a new Cache, along with the Cache so
+// that its Stats can be examined.
+func WithCache(s Store, size int, ttl time.Duration) (Store, *Cache) {
+	c := &Cache{Size: size, TTL: ttl}
+	return Wrap(s, c.Middleware()), c
+}
+
+func (c *Cache) init() {
+	if c.lru != nil {
+		return
+	}
+	c.lru = list.New()
+	c.entries = map[cacheKey]*list.Element{}
+	c.keys = map[Store]*cachedKeys{}
+	c.watching = map[Store]func(){}
+}
+
+func (c *Cache) expiry() time.Time {
+	if c.TTL <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(c.TTL)
+}
+
+func expired(t time.Time) bool {
+	return !t.IsZero() && time.Now().After(t)
+}
+
+// Stats returns the current hit, miss, and eviction counts.
+func (c *Cache) Stats() CacheStats {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.stats
+}
+
+// Stop stops watching the underlying Stores for changes.
+func (c *Cache) Stop() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.init()
+	for s, cancel := range c.watching {
+		if cancel != nil {
+			cancel()
+		}
+		delete(c.watching, s)
+	}
+}
+
+// asWatcher finds the Watcher behind s, looking through any Stores
+// returned by Wrap.
+func asWatcher(s Store) (Watcher, bool) {
+	for {
+		if w, ok := s.(Watcher); ok {
+			return w, true
+		}
+		u, ok := s.(Wrapped)
+		if !ok {
+			return nil, false
+		}
+		s = u.Unwrap()
+	}
+}
+
+func (c *Cache) watch(s Store) {
+	c.mux.Lock()
+	c.init()
+	_, ok := c.watching[s]
+	if !ok {
+		c.watching[s] = nil
+	}
+	c.mux.Unlock()
+	if ok {
+		return
+	}
+	w, ok := asWatcher(s)
+	if !ok {
+		c.mux.Lock()
+		c.watching[s] = func() {}
+		c.mux.Unlock()
+		return
+	}
+	cancel, err := w.Watch(func(e Event) {
+		c.mux.Lock()
+		defer c.mux.Unlock()
+		c.invalidate(s, e.Key)
+		if e.Op == OpLost {
+			delete(c.watching, s)
+		}
+	})
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if err != nil {
+		delete(c.watching, s)
+		return
+	}
+	if _, ok := c.watching[s]; !ok {
+		// The watch was lost or stopped before it was recorded.
+		cancel()
+		return
+	}
+	c.watching[s] = cancel
+}
+
+// watched reports whether changes to s are being watched, or s is not
+// a Watcher, so that what is loaded from s may be cached.  The cancel
+// function in c.watching is nil while the watch is being set up.  It
+// must be called with c.mux held.
+func (c *Cache) watched(s Store) bool {
+	return c.watching[s] != nil
+}
+
+// invalidate must be called with c.mux held.  An empty key
+// invalidates everything cached for s.
+func (c *Cache) invalidate(s Store, key string) {
+	c.gen++
+	delete(c.keys, s)
+	if key != "" {
+		if elem, ok := c.entries[cacheKey{s, key}]; ok {
+			c.lru.Remove(elem)
+			delete(c.entries, cacheKey{s, key})
+		}
+		return
+	}
+	for k, elem := range c.entries {
+		if k.store == s {
+			c.lru.Remove(elem)
+			delete(c.entries, k)
+		}
+	}
+}
+
+// get returns the cached value of key in s and the Codec it is encoded
+// with.  On a miss, it returns the generation to pass to put.
+func (c *Cache) get(s Store, key string) ([]byte, Codec, uint64, bool) {
+	c.watch(s)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	elem, ok := c.entries[cacheKey{s, key}]
+	if ok && expired(elem.Value.(*cacheEntry).expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, cacheKey{s, key})
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, nil, c.gen, false
+	}
+	c.stats.Hits++
+	c.lru.MoveToFront(elem)
+	ent := elem.Value.(*cacheEntry)
+	return ent.buf, ent.codec, 0, true
+}
+
+// put caches buf as the value of key in s, unless something has been
+// invalidated since get returned gen.
+func (c *Cache) put(s Store, key string, buf []byte, codec Codec, gen uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.init()
+	if gen != c.gen || !c.watched(s) {
+		return
+	}
+	k := cacheKey{s, key}
+	if elem, ok := c.entries[k]; ok {
+		ent := elem.Value.(*cacheEntry)
+		ent.buf, ent.codec, ent.expires = buf, codec, c.expiry()
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[k] = c.lru.PushFront(&cacheEntry{cacheKey: k, buf: buf, codec: codec, expires: c.expiry()})
+	for c.Size > 0 && c.lru.Len() > c.Size {
+		elem := c.lru.Back()
+		c.lru.Remove(elem)
+		delete(c.entries, elem.Value.(*cacheEntry).cacheKey)
+		c.stats.Evictions++
+	}
+}
+
+func (c *Cache) getKeys(s Store) ([]string, uint64, bool) {
+	c.watch(s)
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	ck, ok := c.keys[s]
+	if !ok || expired(ck.expires) {
+		delete(c.keys, s)
+		c.stats.Misses++
+		return nil, c.gen, false
+	}
+	c.stats.Hits++
+	return append([]string{}, ck.keys...), 0, true
+}
+
+func (c *Cache) putKeys(s Store, keys []string, gen uint64) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.init()
+	if gen != c.gen || !c.watched(s) {
+		return
+	}
+	c.keys[s] = &cachedKeys{keys: append([]string{}, keys...), expires: c.expiry()}
+}
+
+func (c *Cache) drop(s Store, key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.init()
+	c.invalidate(s, key)
+}
+
+// owner returns the Store that actually holds key, looking through
+// the layers of StackedStores.
+func owner(s Store, key string) Store {
+	st, ok := s.(*StackedStore)
+	if !ok {
+		return s
+	}
+	st.RLock()
+	defer st.RUnlock()
+	idx, ok := st.keys[key]
+	if !ok {
+		return s
+	}
+	return owner(st.stores[idx], key)
+}
+
+func cacheCodec(s Store) Codec {
+	if codec := s.GetCodec(); codec != nil {
+		return codec
+	}
+	return DefaultCodec
+}
+
+// fetch loads the bytes of key from s along with the Codec they are
+// encoded with.  If s is not a RawStore, the value is loaded through
+// next into an interface{} and encoded again, so that nothing in it is
+// lost whatever type the caller loads it into.
+func fetch(call *Call, next Handler) ([]byte, Codec, error) {
+	s := call.Store
+	codec := keyCodec(s, call.Key)
+	if raw, ok := s.(RawStore); ok {
+		buf, err := raw.LoadRaw(call.Key)
+		return buf, codec, err
+	}
+	val, err := anyValue(codec, func(v interface{}) error {
+		sub := *call
+		sub.Val = v
+		return next(&sub)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	buf, err := codec.Encode(val)
+	return buf, codec, err
+}
+
+// deliver decodes buf into the value call is loading.
+func deliver(call *Call, buf []byte, codec Codec) error {
+	if err := codec.Decode(buf, call.Val); err != nil {
+		return err
+	}
+	src := owner(call.Store, call.Key)
+	if ro, ok := call.Val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(src.ReadOnly())
+	}
+	if bb, ok := call.Val.(BundleSetter); ok {
+		if n := src.Name(); n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+// Middleware returns the Middleware that implements the Cache.
+func (c *Cache) Middleware() Middleware {
+	return func(call *Call, next Handler) error {
+		s := call.Store
+		switch call.Op {
+		case OpKeys:
+			keys, gen, ok := c.getKeys(s)
+			if ok {
+				call.Keys = keys
+				return nil
+			}
+			err := next(call)
+			if err == nil {
+				c.putKeys(s, call.Keys, gen)
+			}
+			return err
+		case OpLoad:
+			buf, codec, gen, ok := c.get(s, call.Key)
+			if !ok {
+				var err error
+				if buf, codec, err = fetch(call, next); err != nil {
+					return err
+				}
+				c.put(s, call.Key, buf, codec, gen)
+			}
+			return deliver(call, buf, codec)
+		case OpSave, OpRemove:
+			err := next(call)
+			c.drop(s, call.Key)
+			return err
+		default:
+			return next(call)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+type watchedMemory struct {
+	*Memory
+	fns     []func(Event)
+	watches int
+	err     error
+}
+
+func (w *watchedMemory) Watch(fn func(Event)) (func(), error) {
+	if w.err != nil {
+		return nil, w.err
+	}
+	w.watches++
+	w.fns = append(w.fns, fn)
+	return func() { w.fns = nil }, nil
+}
+
+// lose ends the watches on w as a dropped connection would.
+func (w *watchedMemory) lose() {
+	fns := w.fns
+	w.fns = nil
+	for _, fn := range fns {
+		fn(Event{Op: OpLost})
+	}
+}
+
+func (w *watchedMemory) notify(key string) {
+	for _, fn := range w.fns {
+		fn(Event{Key: key, Op: OpSave})
+	}
+}
+
+func TestCachedStore(t *testing.T) {
+	base, _ := Open("memory:///")
+	s, _ := WithCache(base, 10, time.Minute)
+	testStore(t, s)
+}
+
+func TestCache(t *testing.T) {
+	base := &watchedMemory{Memory: &Memory{}}
+	base.Open(nil)
+	backendLoads := 0
+	counted := Wrap(base, func(c *Call, next Handler) error {
+		if c.Op == OpLoad {
+			backendLoads++
+		}
+		return next(c)
+	})
+	s, cache := WithCache(counted, 2, 0)
+
+	tobj := struct{ Foo, Bar string }{"foo", "bar"}
+	for _, k := range []string{"a", "b", "c"} {
+		if err := base.Save(k, &tobj); err != nil {
+			t.Fatalf("Error saving %s: %v", k, err)
+		}
+	}
+	var tgt struct{ Foo, Bar string }
+	start := cache.Stats()
+	s.Load("a", &tgt)
+	s.Load("a", &tgt)
+	if backendLoads != 1 {
+		t.Errorf("Expected 1 backend load, got %d", backendLoads)
+	}
+	st := cache.Stats()
+	if st.Hits-start.Hits != 1 || st.Misses-start.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %#v", st)
+	}
+	s.Load("b", &tgt)
+	s.Load("c", &tgt)
+	if cache.Stats().Evictions-start.Evictions != 1 {
+		t.Errorf("Expected an eviction once the cache was full")
+	}
+	backendLoads = 0
+	s.Load("a", &tgt)
+	if backendLoads != 1 {
+		t.Errorf("Expected evicted key to be reloaded")
+	}
+	tobj.Foo = "changed"
+	base.Save("a", &tobj)
+	base.notify("a")
+	s.Load("a", &tgt)
+	if tgt.Foo != "changed" {
+		t.Errorf("Expected watch notification to invalidate the cached value")
+	}
+	cache.Stop()
+}
+
+func TestCacheTTL(t *testing.T) {
+	base, _ := Open("memory:///")
+	s, cache := WithCache(base, 0, time.Millisecond)
+	tobj := struct{ Foo string }{"foo"}
+	s.Save("a", &tobj)
+	keys, _ := s.Keys()
+	if len(keys) != 1 {
+		t.Errorf("Expected 1 key, got %d", len(keys))
+	}
+	base.Save("b", &tobj)
+	time.Sleep(5 * time.Millisecond)
+	keys, _ = s.Keys()
+	if len(keys) != 2 {
+		t.Errorf("Expected key list to expire, got %v", keys)
+	}
+	if cache.Stats().Hits != 0 {
+		t.Errorf("Expected no cache hits, got %d", cache.Stats().Hits)
+	}
+}
+
+func TestCacheKeepsWholeValue(t *testing.T) {
+	base, _ := Open("memory:///")
+	s, _ := WithCache(base, 0, 0)
+	base.Save("a", &struct{ Foo, Bar string }{"foo", "bar"})
+	var partial struct{ Foo string }
+	if err := s.Load("a", &partial); err != nil || partial.Foo != "foo" {
+		t.Fatalf("Failed to load a: %v, %v", partial, err)
+	}
+	var full struct{ Foo, Bar string }
+	if err := s.Load("a", &full); err != nil || full.Bar != "bar" {
+		t.Errorf("Expected the cached value to keep Bar, got %v, %v", full, err)
+	}
+}
+
+func TestCacheStalePut(t *testing.T) {
+	base, _ := Open("memory:///")
+	base.Save("a", &struct{ Foo string }{"old"})
+	var s Store
+	saving := true
+	racing := Wrap(base, func(c *Call, next Handler) error {
+		err := next(c)
+		if c.Op == OpLoad && saving {
+			saving = false
+			s.Save("a", &struct{ Foo string }{"new"})
+		}
+		return err
+	})
+	s, _ = WithCache(racing, 0, 0)
+	var tgt struct{ Foo string }
+	s.Load("a", &tgt)
+	s.Load("a", &tgt)
+	if tgt.Foo != "new" {
+		t.Errorf("Expected a value loaded during a save not to be cached, got %q", tgt.Foo)
+	}
+}
+
+func TestCacheLostWatch(t *testing.T) {
+	base := &watchedMemory{Memory: &Memory{}}
+	base.Open(nil)
+	s, _ := WithCache(base, 0, 0)
+	base.Save("a", &TestVal{Name: "old"})
+	val := &TestVal{}
+	s.Load("a", val)
+	base.lose()
+	base.Memory.Save("a", &TestVal{Name: "new"})
+	if s.Load("a", val); val.Name != "new" {
+		t.Errorf("Expected a lost watch to invalidate the cache, loaded %q", val.Name)
+	}
+	if base.watches != 2 {
+		t.Errorf("Expected the cache to watch again, watched %d times", base.watches)
+	}
+	base.Memory.Save("a", &TestVal{Name: "unseen"})
+	if s.Load("a", val); val.Name != "new" {
+		t.Errorf("Expected the value to be cached once watched again, loaded %q", val.Name)
+	}
+
+	base.err = fmt.Errorf("No watching today")
+	base.lose()
+	base.Memory.Save("a", &TestVal{Name: "first"})
+	s.Load("a", val)
+	base.Memory.Save("a", &TestVal{Name: "second"})
+	if s.Load("a", val); val.Name != "second" {
+		t.Errorf("Expected nothing to be cached while the store cannot be watched, loaded %q", val.Name)
+	}
+	base.err = nil
+	s.Load("a", val)
+	if base.watches != 3 {
+		t.Errorf("Expected the cache to retry watching, watched %d times", base.watches)
+	}
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// CanonicalJsonCodec returns a Codec that writes JSON meant to be kept
+// in version control.  Object keys are always sorted, including the
+// fields of structs, each level of nesting is indented by indent, HTML
+// characters are left unescaped, and the output ends with a newline if
+// trailingNewline is set.  An empty indent writes compact JSON.
+// Values encoded by the same data always produce the same bytes, so
+// diffs only show real changes.
+func CanonicalJsonCodec(indent string, trailingNewline bool) Codec {
+	return &codec{
+		enc: func(i interface{}) ([]byte, error) {
+			return canonicalJson(i, indent, trailingNewline)
+		},
+		dec:    json.Unmarshal,
+		strict: jsonStrict,
+		ext:    ".json",
+		json:   true,
+	}
+}
+
+// CanonicalCodec is the canonical JSON Codec registered as
+// "canonical".  It indents with two spaces and ends with a newline.
+var CanonicalCodec = CanonicalJsonCodec("  ", true)
+
+func canonicalJson(i interface{}, indent string, trailingNewline bool) ([]byte, error) {
+	buf, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	// Round trip through interface{} so that struct fields get sorted
+	// like map keys.  UseNumber keeps numbers exactly as they were.
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	res := &bytes.Buffer{}
+	enc := json.NewEncoder(res)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", indent)
+	if err := enc.Encode(val); err != nil {
+		return nil, err
+	}
+	out := res.Bytes()
+	if !trailingNewline {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+	return out, nil
+}
+
+func init() {
+	RegisterCodec("canonical", CanonicalCodec)
+}
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+type canonicalVal struct {
+	Zed   string
+	Alpha map[string]interface{}
+	Mid   int64
+}
+
+func TestCanonicalCodec(t *testing.T) {
+	val := &canonicalVal{
+		Zed:   "<last>",
+		Alpha: map[string]interface{}{"b": 1, "a": []int{1, 2}},
+		Mid:   1 << 60,
+	}
+	expected := `{
+  "Alpha": {
+    "a": [
+      1,
+      2
+    ],
+    "b": 1
+  },
+  "Mid": 1152921504606846976,
+  "Zed": "<last>"
+}
+`
+	buf, err := CanonicalCodec.Encode(val)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+	if string(buf) != expected {
+		t.Errorf("Unexpected canonical encoding:\n%s", string(buf))
+	}
+	buf, _ = CanonicalJsonCodec("", false).Encode(val)
+	if string(buf) != `{"Alpha":{"a":[1,2],"b":1},"Mid":1152921504606846976,"Zed":"<last>"}` {
+		t.Errorf("Unexpected compact canonical encoding: %s", string(buf))
+	}
+}
+
+func TestCanonicalRewrite(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s, err := Open("directory:" + tmpDir + "?codec=json")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	sub, _ := s.MakeSub("sub")
+	val := &canonicalVal{Zed: "z", Mid: 1}
+	s.Save("top", val)
+	sub.Save("nested", val)
+	s.Close()
+	s, err = Open("directory:" + tmpDir + "?codec=canonical")
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if err := s.(MetaSaver).SetMetaData(map[string]string{"Name": "content"}); err != nil {
+		t.Fatalf("Failed to set metadata: %v", err)
+	}
+	if err := Copy(s, s); err == nil {
+		t.Errorf("Expected copying a store to itself without Rewrite to fail")
+	}
+	if err := Copy(s, s, Rewrite()); err != nil {
+		t.Fatalf("Failed to rewrite store: %v", err)
+	}
+	expected := "{\n  \"Alpha\": null,\n  \"Mid\": 1,\n  \"Zed\": \"z\"\n}\n"
+	for _, name := range []string{"top.json", "sub/nested.json"} {
+		buf, err := ioutil.ReadFile(path.Join(tmpDir, name))
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", name, err)
+		} else if string(buf) != expected {
+			t.Errorf("%s was not rewritten canonically:\n%s", name, string(buf))
+		}
+	}
+	if s.(MetaSaver).MetaData()["Name"] != "content" {
+		t.Errorf("Rewriting the store lost its metadata")
+	}
+}
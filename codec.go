@@ -1,15 +1,27 @@
 package store
 
 import (
+	"bytes"
+	"encoding/gob"
 	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 
+	"github.com/fxamacker/cbor/v2"
 	"github.com/ghodss/yaml"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/vmihailenco/msgpack/v5"
 )
 
 type codec struct {
-	enc func(interface{}) ([]byte, error)
-	dec func([]byte, interface{}) error
-	ext string
+	enc    func(interface{}) ([]byte, error)
+	dec    func([]byte, interface{}) error
+	strict func([]byte, interface{}) error
+	ext    string
+	json   bool
 }
 
 func (c *codec) Encode(i interface{}) ([]byte, error) {
@@ -24,6 +36,10 @@ func (c *codec) Ext() string {
 	return c.ext
 }
 
+func (c *codec) viaJson() bool {
+	return c.json
+}
+
 // Codec is responsible for encoding and decoding raw Go objects into
 // a serializable form.
 type Codec interface {
@@ -38,9 +54,11 @@ type Codec interface {
 
 // JsonCodec implements Codec for encoding/decoding to JSON.
 var JsonCodec = &codec{
-	enc: json.Marshal,
-	dec: json.Unmarshal,
-	ext: ".json",
+	enc:    json.Marshal,
+	dec:    json.Unmarshal,
+	strict: jsonStrict,
+	ext:    ".json",
+	json:   true,
 }
 
 func yamlDecode(buf []byte, d interface{}) error {
@@ -49,9 +67,338 @@ func yamlDecode(buf []byte, d interface{}) error {
 
 // YamlCodec implements a Codec for encoding/decoding to YAML
 var YamlCodec = &codec{
-	enc: yaml.Marshal,
-	dec: yamlDecode,
-	ext: ".yaml",
+	enc:    yaml.Marshal,
+	dec:    yamlDecode,
+	strict: yamlStrict,
+	ext:    ".yaml",
+	json:   true,
+}
+
+var cborDecMode, _ = cbor.DecOptions{
+	DefaultMapType: reflect.TypeOf(map[string]interface{}{}),
+}.DecMode()
+
+// CborCodec implements a Codec for encoding/decoding to CBOR.  Struct
+// fields are named using their cbor or json tags.
+var CborCodec = &codec{
+	enc:    cbor.Marshal,
+	dec:    cborDecMode.Unmarshal,
+	strict: cborStrict,
+	ext:    ".cbor",
+}
+
+func msgpackEncode(i interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := msgpack.NewEncoder(buf)
+	enc.SetCustomStructTag("json")
+	err := enc.Encode(i)
+	return buf.Bytes(), err
+}
+
+func msgpackDecode(buf []byte, i interface{}) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(buf))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(i)
+}
+
+// MsgpackCodec implements a Codec for encoding/decoding to
+// MessagePack.  Struct fields are named using their json tags.
+var MsgpackCodec = &codec{
+	enc:    msgpackEncode,
+	dec:    msgpackDecode,
+	strict: msgpackStrict,
+	ext:    ".msgpack",
+}
+
+// TomlCodec implements a Codec for encoding/decoding to TOML.  TOML
+// documents must be tables, so only structs and maps can be saved
+// with it.
+var TomlCodec = &codec{
+	enc:    toml.Marshal,
+	dec:    toml.Unmarshal,
+	strict: tomlStrict,
+	ext:    ".toml",
+}
+
+func gobEncode(i interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(i)
+	return buf.Bytes(), err
+}
+
+func gobDecode(buf []byte, i interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(buf)).Decode(i)
+}
+
+// GobCodec implements a Codec for encoding/decoding with
+// encoding/gob.  gob can only decode values into concrete types, so
+// the File store refuses GobCodec, and Copy fails unless both Stores
+// are RawStores using it, in which case values are copied as is.
+var GobCodec = &codec{
+	enc: gobEncode,
+	dec: gobDecode,
+	ext: ".gob",
+}
+
+// isGob returns true if c is GobCodec, possibly wrapped by other
+// Codecs, which keep the extension of the Codec they wrap.
+func isGob(c Codec) bool {
+	return c.Ext() == GobCodec.Ext()
 }
 
 var DefaultCodec = JsonCodec
+
+// jsonBased is implemented by Codecs that decode by way of JSON.
+// Values they decode can be loaded into a json.RawMessage without
+// losing anything.
+type jsonBased interface {
+	viaJson() bool
+}
+
+func isJsonBased(c Codec) bool {
+	j, ok := c.(jsonBased)
+	return ok && j.viaJson()
+}
+
+// exactNumbers replaces the json.Numbers in v with an int64 or uint64
+// if they are integers that fit, and a float64 otherwise.
+func exactNumbers(v interface{}) interface{} {
+	switch val := v.(type) {
+	case json.Number:
+		if i, err := val.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(val), 10, 64); err == nil {
+			return u
+		}
+		f, _ := val.Float64()
+		return f
+	case map[string]interface{}:
+		for k, sub := range val {
+			val[k] = exactNumbers(sub)
+		}
+	case []interface{}:
+		for i := range val {
+			val[i] = exactNumbers(val[i])
+		}
+	}
+	return v
+}
+
+// anyValue calls load to decode a value into an interface{}.  Unlike
+// decoding straight into an interface{}, integers that JSON-based
+// Codecs would turn into float64 keep their exact value.
+func anyValue(c Codec, load func(interface{}) error) (interface{}, error) {
+	if isGob(c) {
+		return nil, fmt.Errorf("Cannot decode gob values without knowing their type")
+	}
+	var res interface{}
+	if !isJsonBased(c) {
+		err := load(&res)
+		return res, err
+	}
+	var raw json.RawMessage
+	if err := load(&raw); err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&res); err != nil {
+		return nil, err
+	}
+	return exactNumbers(res), nil
+}
+
+// decodeAny decodes buf with c into an interface{} without losing
+// the precision of numbers.
+func decodeAny(c Codec, buf []byte) (interface{}, error) {
+	return anyValue(c, func(v interface{}) error {
+		return c.Decode(buf, v)
+	})
+}
+
+// keyCodecer is implemented by Stores that can hold values encoded
+// with Codecs other than their own.
+type keyCodecer interface {
+	codecOf(key string) Codec
+}
+
+// keyCodec returns the Codec key is encoded with in s.
+func keyCodec(s Store, key string) Codec {
+	src := owner(s, key)
+	if kc, ok := src.(keyCodecer); ok {
+		return kc.codecOf(key)
+	}
+	return cacheCodec(src)
+}
+
+// saveCodec returns the Codec s will encode key with when it is
+// saved.
+func saveCodec(s Store, key string) Codec {
+	if st, ok := s.(*StackedStore); ok {
+		st.RLock()
+		defer st.RUnlock()
+		return saveCodec(st.stores[0], key)
+	}
+	if kc, ok := s.(keyCodecer); ok {
+		return kc.codecOf(key)
+	}
+	return cacheCodec(s)
+}
+
+// loadAny loads key from s into an interface{} without losing the
+// precision of numbers.
+func loadAny(s Store, key string) (interface{}, error) {
+	return anyValue(keyCodec(s, key), func(v interface{}) error {
+		return s.Load(key, v)
+	})
+}
+
+// encodedValue returns the bytes key is stored as in s, and the Codec
+// they are encoded with.  If s is not a RawStore, the value is loaded
+// and encoded again.
+func encodedValue(s Store, key string) ([]byte, Codec, error) {
+	codec := keyCodec(s, key)
+	if raw, ok := s.(RawStore); ok {
+		buf, err := raw.LoadRaw(key)
+		return buf, codec, err
+	}
+	val, err := loadAny(s, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	buf, err := codec.Encode(val)
+	return buf, codec, err
+}
+
+// loadJSON loads key from s as JSON, whatever Codec it is encoded
+// with.
+func loadJSON(s Store, key string) ([]byte, error) {
+	val, err := loadAny(s, key)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(val)
+}
+
+// toJSON encodes val with c, and then converts it to JSON.  Going
+// through c means val is encoded just as c would store it.
+func toJSON(c Codec, val interface{}) ([]byte, error) {
+	buf, err := c.Encode(val)
+	if err != nil {
+		return nil, err
+	}
+	return rawToJSON(c, buf)
+}
+
+// rawToJSON converts buf from what c encodes values to into JSON.
+func rawToJSON(c Codec, buf []byte) ([]byte, error) {
+	if c == JsonCodec {
+		return buf, nil
+	}
+	v, err := decodeAny(c, buf)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+// fromJSON converts buf from JSON to what c would encode it to, so
+// that c decodes it just as it would any other value.
+func fromJSON(c Codec, buf []byte) ([]byte, error) {
+	if c == JsonCodec {
+		return buf, nil
+	}
+	v, err := decodeAny(JsonCodec, buf)
+	if err != nil {
+		return nil, err
+	}
+	return c.Encode(v)
+}
+
+var codecRegistry = struct {
+	sync.RWMutex
+	names    []string
+	codecs   map[string]Codec
+	wrappers map[string]func(Codec) (Codec, error)
+}{
+	names: []string{"json", "yaml", "cbor", "msgpack", "toml", "gob"},
+	codecs: map[string]Codec{
+		"json":    JsonCodec,
+		"yaml":    YamlCodec,
+		"cbor":    CborCodec,
+		"msgpack": MsgpackCodec,
+		"toml":    TomlCodec,
+		"gob":     GobCodec,
+	},
+	wrappers: map[string]func(Codec) (Codec, error){},
+}
+
+// codecsByExt returns the first registered Codec for each file
+// extension.
+func codecsByExt() map[string]Codec {
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	res := map[string]Codec{}
+	for _, name := range codecRegistry.names {
+		c := codecRegistry.codecs[name]
+		if _, ok := res[c.Ext()]; !ok {
+			res[c.Ext()] = c
+		}
+	}
+	return res
+}
+
+// RegisterCodec makes c available to Open and CodecFor as name.
+func RegisterCodec(name string, c Codec) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	if _, ok := codecRegistry.codecs[name]; !ok {
+		codecRegistry.names = append(codecRegistry.names, name)
+	}
+	codecRegistry.codecs[name] = c
+}
+
+// RegisterCodecWrapper makes wrap available to Open and CodecFor as
+// name.  wrap should return a Codec that wraps the Codec it is
+// passed.
+func RegisterCodecWrapper(name string, wrap func(Codec) (Codec, error)) {
+	codecRegistry.Lock()
+	defer codecRegistry.Unlock()
+	codecRegistry.wrappers[name] = wrap
+}
+
+// CodecFor returns the Codec registered as name.  name can be
+// followed by the names of registered wrappers separated by + (or
+// spaces, as + in a URL query means space), in which case the Codec
+// is wrapped by each in turn.  "json+gzip" is JsonCodec wrapped by the
+// gzip wrapper.  An empty name or "default" is DefaultCodec.
+func CodecFor(name string) (Codec, error) {
+	parts := strings.FieldsFunc(name, func(r rune) bool {
+		return r == '+' || r == ' '
+	})
+	if len(parts) == 0 {
+		return DefaultCodec, nil
+	}
+	codecRegistry.RLock()
+	defer codecRegistry.RUnlock()
+	var res Codec
+	if parts[0] == "default" {
+		res = DefaultCodec
+	} else if c, ok := codecRegistry.codecs[parts[0]]; ok {
+		res = c
+	} else {
+		return nil, fmt.Errorf("Unknown codec %s", parts[0])
+	}
+	for _, part := range parts[1:] {
+		wrap, ok := codecRegistry.wrappers[part]
+		if !ok {
+			return nil, fmt.Errorf("Unknown codec wrapper %s", part)
+		}
+		var err error
+		if res, err = wrap(res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
@@ -1,7 +1,10 @@
 package store
 
 import (
+	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/url"
 	"os"
 	"path"
@@ -9,6 +12,11 @@ import (
 )
 
 func safeReplace(name string, contents []byte) error {
+	return safeReplaceFrom(name, bytes.NewReader(contents))
+}
+
+// safeReplaceFrom is safeReplace, with the new contents read from r.
+func safeReplaceFrom(name string, r io.Reader) error {
 	tmpName := path.Join(path.Dir(name), ".new."+path.Base(name))
 	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0640)
 	if err != nil {
@@ -16,16 +24,29 @@ func safeReplace(name string, contents []byte) error {
 	}
 	func() {
 		defer f.Close()
-		if _, err = f.Write(contents); err == nil {
+		if _, err = io.Copy(f, r); err == nil {
 			err = f.Sync()
 		}
 	}()
 	if err != nil {
+		os.Remove(tmpName)
 		return err
 	}
 	return os.Rename(tmpName, name)
 }
 
+// encodeOver encodes val with c.  If c can carry comments and
+// formatting over from an existing value and fileName already exists,
+// the contents of fileName are used as the existing value.
+func encodeOver(c Codec, fileName string, val interface{}) ([]byte, error) {
+	if m, ok := c.(mergingCodec); ok {
+		if old, err := ioutil.ReadFile(fileName); err == nil {
+			return m.EncodeOver(old, val)
+		}
+	}
+	return c.Encode(val)
+}
+
 // Open a store via URI style locator. Locators have the following formats:
 //
 // storeType:path?codec=codecType&ro=false&option=foo for stores
@@ -34,15 +55,56 @@ func safeReplace(name string, contents []byte) error {
 // storeType://host:port/path?codec=codecType&ro=false&option=foo for stores
 // that need to talk over the network.
 //
-// All store types take codec and ro as optional parameters
+// All store types take codec and ro as optional parameters.  codec is
+// any name accepted by CodecFor: json, canonical, yaml, yamlv3, cbor,
+// msgpack, toml, or gob, optionally followed by wrappers such as +gzip
+// or +zstd.
+//
+// All store types also take an optional strict parameter.  If strict is
+// true, loading a value with fields its target does not have or with
+// trailing data fails with a *DecodeError.  See StrictCodec.
+//
+// All store types also take one or more keyfile parameters.  If any
+// are present, values are encrypted using the keys in those files,
+// with the first one used to encrypt new values.  See EncryptingCodec
+// and KeyRing.AddFile.
 //
 // The following storeTypes are known:
 //   * file, in which path refers to a single local file.
-//   * directory, in which path refers to a top-level directory
+//   * directory, in which path refers to a top-level directory.  directory
+//     also takes an optional mixed parameter.  If mixed is true, objects
+//     encoded with any registered codec are recognized by their extension.
 //   * consul, in which path refers to the top key in the kv store.
+//   * redis, in which path refers to the name of the hash values are stored
+//     in, and user:password@host:port is the Redis server to talk to.  redis
+//     also takes optional db and ttl parameters.  ttl is how long each
+//     value lives after it was last saved; see Redis.TTL.
+//   * etcd, in which path refers to the key prefix everything is stored
+//     under, and host:port is the etcd server to talk to.  etcd also takes
+//     optional endpoint parameters naming more servers.
+//   * s3, in which host is the bucket and path is the prefix everything is
+//     stored under.  s3 also takes optional endpoint, region, and secure
+//     parameters for S3-compatible servers, and key:secret@ credentials,
+//     which otherwise come from the environment.
+//   * http and https, in which the URL is where an HTTPServer is mounted.
+//     They also take an optional token parameter, which is sent as a
+//     bearer token.  See Remote.
+//   * grpc, in which host:port is where a GRPCServer is listening.  grpc
+//     also takes an optional tls parameter.  See GRPC.
 //   * bolt, in which path refers to the directory where the Bolt database
 //     is located.  bolt also takes an optional bucket parameter to specify the
 //     top-level bucket data is stored in.
+//   * sqlite, in which path refers to the SQLite database file.
+//   * git, in which path refers to a git repository, which is created as a
+//     bare repository if it does not exist.  git also takes optional
+//     branch, ref, author, and email parameters.  See Git.
+//   * tar and zip, in which path refers to an archive laid out like a
+//     directory store, which is always read-only.  tar and zip also take
+//     an optional mixed parameter, which works as it does for directory.
+//     See Archive.
+//   * bundle, in which path refers to a file written by ExportBundle,
+//     which is always read-only.  bundle also takes an optional verify
+//     parameter.  See Bundle.
 //   * memory, in which path does not mean anything.
 //
 func Open(locator string) (Store, error) {
@@ -51,18 +113,26 @@ func Open(locator string) (Store, error) {
 		return nil, err
 	}
 	params := uri.Query()
-	codec := DefaultCodec
 	readOnly := false
-	codecParam := params.Get("codec")
-	switch codecParam {
-	case "yaml":
-		codec = YamlCodec
-	case "json":
-		codec = JsonCodec
-	case "", "default":
-		codec = DefaultCodec
+	codec, err := CodecFor(params.Get("codec"))
+	if err != nil {
+		return nil, err
+	}
+	switch strictParam := params.Get("strict"); strictParam {
+	case "true", "yes", "1":
+		codec = StrictCodec(codec)
+	case "false", "no", "0", "":
 	default:
-		return nil, fmt.Errorf("Unknown codec %s", codecParam)
+		return nil, fmt.Errorf("Unknown strict value %s. Try true or false", strictParam)
+	}
+	if keyFiles, ok := params["keyfile"]; ok {
+		keys := &KeyRing{}
+		for _, keyFile := range keyFiles {
+			if err := keys.AddFile(keyFile); err != nil {
+				return nil, err
+			}
+		}
+		codec = EncryptingCodec(codec, keys)
 	}
 	roParam := params.Get("ro")
 	switch roParam {
@@ -84,15 +154,59 @@ func Open(locator string) (Store, error) {
 	case "file":
 		res = &File{Path: path}
 	case "directory":
-		res = &Directory{Path: path}
+		mixed, err := mixedParam(params)
+		if err != nil {
+			return nil, err
+		}
+		res = &Directory{Path: path, Mixed: mixed}
 	case "bolt":
 		res = &Bolt{Path: path}
 		bucketParam := params.Get("bucket")
 		if bucketParam != "" {
 			res.(*Bolt).Bucket = []byte(bucketParam)
 		}
+	case "sqlite":
+		res = &Sqlite{Path: path}
+	case "git":
+		res = gitFromURI(uri, path)
+	case "tar", "zip":
+		mixed, err := mixedParam(params)
+		if err != nil {
+			return nil, err
+		}
+		res = &Archive{Path: path, Format: uri.Scheme, Mixed: mixed}
+	case "bundle":
+		res = &Bundle{Path: path}
+		switch verifyParam := params.Get("verify"); verifyParam {
+		case "true", "yes", "1":
+			res.(*Bundle).Verify = true
+		case "false", "no", "0", "":
+		default:
+			return nil, fmt.Errorf("Unknown verify value %s. Try true or false", verifyParam)
+		}
 	case "consul":
 		res = &Consul{BaseKey: path}
+	case "redis":
+		if res, err = redisFromURI(uri, path); err != nil {
+			return nil, err
+		}
+	case "etcd":
+		etcd := &Etcd{BaseKey: path}
+		if uri.Host != "" {
+			etcd.Endpoints = append(etcd.Endpoints, uri.Host)
+		}
+		etcd.Endpoints = append(etcd.Endpoints, params["endpoint"]...)
+		res = etcd
+	case "s3":
+		if res, err = s3FromURI(uri, path); err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		res = remoteFromURI(uri)
+	case "grpc":
+		if res, err = grpcFromURI(uri); err != nil {
+			return nil, err
+		}
 	case "memory":
 		res = &Memory{}
 	}
@@ -108,6 +222,18 @@ func Open(locator string) (Store, error) {
 	return res, nil
 }
 
+// mixedParam parses the mixed parameter of a locator.
+func mixedParam(params url.Values) (bool, error) {
+	switch mixed := params.Get("mixed"); mixed {
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0", "":
+		return false, nil
+	default:
+		return false, fmt.Errorf("Unknown mixed value %s. Try true or false", mixed)
+	}
+}
+
 // Store provides an interface for some very basic key/value
 // storage needs.  Each Store (including ones created with MakeSub()
 // should operate as seperate, flat key/value stores.
@@ -164,11 +290,68 @@ type MetaSaver interface {
 	SetMetaData(map[string]string) error
 }
 
+// RawStore is a Store that can load and save values as the bytes its
+// Codec encodes them to, without decoding them.  SaveRaw does not check
+// that buf can be decoded, so it is up to the caller to pass bytes
+// encoded by the Store's Codec.
+type RawStore interface {
+	Store
+	LoadRaw(key string) ([]byte, error)
+	SaveRaw(key string, buf []byte) error
+}
+
+// StreamStore is a Store that can save and load large values without
+// holding them in memory all at once.  Like the bytes passed to
+// SaveRaw, streams are not passed through the Store's Codec.
+// SaveStream reads r until io.EOF, and the caller must close the
+// io.ReadCloser returned by LoadStream.
+type StreamStore interface {
+	Store
+	SaveStream(key string, r io.Reader) error
+	LoadStream(key string) (io.ReadCloser, error)
+}
+
+// CopyOption changes how Copy behaves.
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	rewrite bool
+}
+
+// Rewrite makes Copy decode every value from src and encode it again
+// with dst's Codec, and allows dst and src to be the same Store, in
+// which case every value in it is rewritten in place.  Rewriting a
+// Directory store with the canonical codec is done like this:
+//
+//	s, _ := Open("directory:/path/to/content?codec=canonical")
+//	err := Copy(s, s, Rewrite())
+func Rewrite() CopyOption {
+	return func(o *copyOptions) {
+		o.rewrite = true
+	}
+}
+
 // Copy copies all of the contents from src to dest, including substores and
 // metadata.  If dst starts out empty, then dst will wind up being a clone of src.
-func Copy(dst, src Store) error {
-	src.RLock()
-	defer src.RUnlock()
+// Unless Rewrite is passed, values are copied as raw bytes when both
+// Stores are RawStores using the same Codec, and dst and src must be
+// different Stores.
+func Copy(dst, src Store, opts ...CopyOption) error {
+	o := &copyOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if dst == src && !o.rewrite {
+		return fmt.Errorf("Cannot copy a store to itself without Rewrite")
+	}
+	return copyStore(dst, src, o)
+}
+
+func copyStore(dst, src Store, o *copyOptions) error {
+	if dst != src {
+		src.RLock()
+		defer src.RUnlock()
+	}
 	dmeta, dok := dst.(MetaSaver)
 	smeta, sok := src.(MetaSaver)
 	if dok && sok {
@@ -180,9 +363,21 @@ func Copy(dst, src Store) error {
 	if err != nil {
 		return err
 	}
+	rawSrc, sok := src.(RawStore)
+	rawDst, dok := dst.(RawStore)
 	for _, key := range keys {
-		var val interface{}
-		if err := src.Load(key, &val); err != nil {
+		if sok && dok && !o.rewrite && keyCodec(src, key) == saveCodec(dst, key) {
+			buf, err := rawSrc.LoadRaw(key)
+			if err != nil {
+				return err
+			}
+			if err := rawDst.SaveRaw(key, buf); err != nil {
+				return err
+			}
+			continue
+		}
+		val, err := loadAny(src, key)
+		if err != nil {
 			return err
 		}
 		if err := dst.Save(key, val); err != nil {
@@ -194,7 +389,7 @@ func Copy(dst, src Store) error {
 		if err != nil {
 			return err
 		}
-		if err := Copy(subDst, sub); err != nil {
+		if err := copyStore(subDst, sub, o); err != nil {
 			return err
 		}
 	}
@@ -244,16 +439,23 @@ func (s *storeBase) Name() string {
 	return s.name
 }
 
+// forceClose closes s and all of its substores, however deeply nested.
 func (s *storeBase) forceClose() {
 	s.Lock()
-	defer s.Unlock()
-	if !s.opened {
-		return
+	if s.opened {
+		if s.closer != nil {
+			s.closer()
+		}
+		s.opened = false
 	}
-	if s.closer != nil {
-		s.closer()
+	subs := make([]Store, 0, len(s.subStores))
+	for _, sub := range s.subStores {
+		subs = append(subs, sub)
+	}
+	s.Unlock()
+	for _, sub := range subs {
+		sub.(forceCloser).forceClose()
 	}
-	s.opened = false
 }
 
 func (s *storeBase) Close() {
@@ -261,9 +463,6 @@ func (s *storeBase) Close() {
 	if s.parentStore == nil {
 		s.Unlock()
 		s.forceClose()
-		for _, sub := range s.subStores {
-			sub.(forceCloser).forceClose()
-		}
 		return
 	}
 	parent := s.parentStore
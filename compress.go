@@ -0,0 +1,138 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMagic starts every value written by a compressing Codec.
+// It is followed by a single byte identifying the algorithm.
+var compressMagic = []byte("DRSZ")
+
+// Compression algorithms supported by CompressingCodec.
+const (
+	Gzip = "gzip"
+	Zstd = "zstd"
+)
+
+var algoTags = map[string]byte{Gzip: 'g', Zstd: 'z'}
+
+// DefaultCompressThreshold is the size in bytes an encoded value must
+// reach before the compressing Codecs registered with CodecFor will
+// compress it.
+var DefaultCompressThreshold = 1024
+
+var zstdCoders struct {
+	sync.Once
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+	err error
+}
+
+func zstdInit() error {
+	zstdCoders.Do(func() {
+		zstdCoders.enc, zstdCoders.err = zstd.NewWriter(nil)
+		if zstdCoders.err == nil {
+			zstdCoders.dec, zstdCoders.err = zstd.NewReader(nil)
+		}
+	})
+	return zstdCoders.err
+}
+
+type compressingCodec struct {
+	inner     Codec
+	algo      string
+	threshold int
+}
+
+// CompressingCodec returns a Codec that compresses values encoded by
+// inner with algo once they are at least threshold bytes long.
+// Compressed values start with a magic header, and values without it
+// are passed straight to inner, so existing uncompressed data can
+// still be read.  Values compressed with any supported algorithm can
+// be read, no matter which algo is used for writing.
+func CompressingCodec(inner Codec, algo string, threshold int) (Codec, error) {
+	if _, ok := algoTags[algo]; !ok {
+		return nil, fmt.Errorf("Unknown compression algorithm %s", algo)
+	}
+	if algo == Zstd {
+		if err := zstdInit(); err != nil {
+			return nil, err
+		}
+	}
+	return &compressingCodec{inner: inner, algo: algo, threshold: threshold}, nil
+}
+
+func (c *compressingCodec) Ext() string {
+	return c.inner.Ext()
+}
+
+func (c *compressingCodec) viaJson() bool {
+	return isJsonBased(c.inner)
+}
+
+func (c *compressingCodec) Encode(i interface{}) ([]byte, error) {
+	buf, err := c.inner.Encode(i)
+	if err != nil || len(buf) < c.threshold {
+		return buf, err
+	}
+	res := bytes.NewBuffer(append(append([]byte{}, compressMagic...), algoTags[c.algo]))
+	switch c.algo {
+	case Gzip:
+		w := gzip.NewWriter(res)
+		if _, err := w.Write(buf); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return res.Bytes(), nil
+	default:
+		return zstdCoders.enc.EncodeAll(buf, res.Bytes()), nil
+	}
+}
+
+func (c *compressingCodec) decompress(buf []byte) ([]byte, error) {
+	if !bytes.HasPrefix(buf, compressMagic) || len(buf) == len(compressMagic) {
+		return buf, nil
+	}
+	body := buf[len(compressMagic)+1:]
+	switch buf[len(compressMagic)] {
+	case algoTags[Gzip]:
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	case algoTags[Zstd]:
+		if err := zstdInit(); err != nil {
+			return nil, err
+		}
+		return zstdCoders.dec.DecodeAll(body, nil)
+	default:
+		return nil, fmt.Errorf("Unknown compression algorithm tag %q", buf[len(compressMagic)])
+	}
+}
+
+func (c *compressingCodec) Decode(buf []byte, i interface{}) error {
+	plain, err := c.decompress(buf)
+	if err != nil {
+		return err
+	}
+	return c.inner.Decode(plain, i)
+}
+
+func init() {
+	for _, algo := range []string{Gzip, Zstd} {
+		algo := algo
+		RegisterCodecWrapper(algo, func(c Codec) (Codec, error) {
+			return CompressingCodec(c, algo, DefaultCompressThreshold)
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package store
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompressingCodec(t *testing.T) {
+	big := struct{ Foo string }{strings.Repeat("compress me ", 200)}
+	small := struct{ Foo string }{"tiny"}
+	for _, algo := range []string{Gzip, Zstd} {
+		codec, err := CompressingCodec(JsonCodec, algo, 100)
+		if err != nil {
+			t.Fatalf("Failed to create %s codec: %v", algo, err)
+		}
+		buf, err := codec.Encode(&big)
+		if err != nil {
+			t.Fatalf("%s: failed to encode: %v", algo, err)
+		}
+		if !bytes.HasPrefix(buf, compressMagic) {
+			t.Errorf("%s: large value was not compressed", algo)
+		}
+		plain, _ := JsonCodec.Encode(&big)
+		if len(buf) >= len(plain) {
+			t.Errorf("%s: compressed value is not smaller: %d >= %d", algo, len(buf), len(plain))
+		}
+		var res struct{ Foo string }
+		if err := codec.Decode(buf, &res); err != nil || res.Foo != big.Foo {
+			t.Errorf("%s: large value did not round trip: %v", algo, err)
+		}
+		buf, _ = codec.Encode(&small)
+		if bytes.HasPrefix(buf, compressMagic) {
+			t.Errorf("%s: small value was compressed", algo)
+		}
+		legacy, _ := JsonCodec.Encode(&small)
+		if err := codec.Decode(legacy, &res); err != nil || res.Foo != small.Foo {
+			t.Errorf("%s: uncompressed value could not be read: %v", algo, err)
+		}
+	}
+	if _, err := CodecFor("json+lzma"); err == nil {
+		t.Errorf("Expected unknown wrapper to fail")
+	}
+	if c, err := CodecFor("yaml zstd"); err != nil {
+		t.Errorf("Expected query-decoded codec name to work: %v", err)
+	} else if c.Ext() != ".yaml" {
+		t.Errorf("Expected .yaml extension, got %s", c.Ext())
+	}
+}
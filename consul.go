@@ -1,10 +1,17 @@
 package store
 
 import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	consul "github.com/hashicorp/consul/api"
@@ -103,22 +110,78 @@ func (b *Consul) Keys() ([]string, error) {
 		if strings.HasSuffix(keys[i], "/") {
 			continue
 		}
-		res = append(res, strings.TrimPrefix(keys[i], b.BaseKey+"/"))
+		key := strings.TrimPrefix(keys[i], b.BaseKey+"/")
+		if strings.HasPrefix(key, consulChunkDir) {
+			continue
+		}
+		res = append(res, key)
 	}
 	return res, nil
 }
 
-func (b *Consul) Load(key string, val interface{}) error {
+// LoadRaw fetches all of the chunks of a chunked value before
+// returning, and tries again if they were replaced while it did.
+func (b *Consul) LoadRaw(key string) ([]byte, error) {
+	buf, _, err := b.loadRaw(key)
+	return buf, err
+}
+
+// loadRaw is LoadRaw, and also returns the ModifyIndex of key.
+func (b *Consul) loadRaw(key string) ([]byte, uint64, error) {
 	b.panicIfClosed()
-	buf, _, err := b.Client.KV().Get(b.finalKey(key), nil)
-	if buf == nil {
-		return os.ErrNotExist
+	kv := b.Client.KV()
+	for {
+		kp, _, err := kv.Get(b.finalKey(key), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if kp == nil {
+			return nil, 0, os.ErrNotExist
+		}
+		gen, count, chunked, err := consulManifest(kp)
+		if err != nil {
+			return nil, 0, err
+		}
+		if !chunked {
+			return kp.Value, kp.ModifyIndex, nil
+		}
+		chunks, _, err := kv.List(b.chunkPrefix(key, gen), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(chunks) == count {
+			sort.Slice(chunks, func(i, j int) bool { return chunks[i].Key < chunks[j].Key })
+			buf := []byte{}
+			for _, chunk := range chunks {
+				buf = append(buf, chunk.Value...)
+			}
+			return buf, kp.ModifyIndex, nil
+		}
+		// The chunks may have been cleaned up by later saves.
+		now, _, err := kv.Get(b.finalKey(key), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if now == nil || now.ModifyIndex == kp.ModifyIndex {
+			return nil, 0, fmt.Errorf("Chunks of %s are missing", key)
+		}
 	}
+}
+
+func (b *Consul) Load(key string, val interface{}) error {
+	_, err := b.LoadETag(key, val)
+	return err
+}
+
+// LoadETag is Load, and also returns the ETag of key for use with
+// SaveETag, which is the ModifyIndex of key.
+func (b *Consul) LoadETag(key string, val interface{}) (string, error) {
+	buf, index, err := b.loadRaw(key)
 	if err != nil {
-		return err
+		return "", err
 	}
-	if err := b.Decode(buf.Value, val); err != nil {
-		return err
+	if err := b.Decode(buf, val); err != nil {
+		return "", decodeError(b.finalKey(key), key, err)
 	}
 	if ro, ok := val.(ReadOnlySetter); ok {
 		ro.SetReadOnly(b.ReadOnly())
@@ -129,7 +192,7 @@ func (b *Consul) Load(key string, val interface{}) error {
 			bb.SetBundle(n)
 		}
 	}
-	return nil
+	return strconv.FormatUint(index, 10), nil
 }
 
 func (b *Consul) Save(key string, val interface{}) error {
@@ -141,18 +204,274 @@ func (b *Consul) Save(key string, val interface{}) error {
 	if err != nil {
 		return err
 	}
-	kp := &consul.KVPair{Value: buf, Key: b.finalKey(key)}
-	_, err = b.Client.KV().Put(kp, nil)
+	return b.SaveRaw(key, buf)
+}
+
+func (b *Consul) SaveRaw(key string, buf []byte) error {
+	return b.SaveStream(key, bytes.NewReader(buf))
+}
+
+// ConsulChunkSize is the largest value the Consul store will save as a
+// single key.  Consul limits values to 512 KiB by default.  Larger
+// values are split into chunks of this size, which are saved under
+// ._chunks/key/gen in the Store, where gen is unique to each save.  key
+// then holds a manifest naming gen and how many chunks there are.  The
+// manifest is swapped in with a check-and-set once every chunk has been
+// saved.  The chunks of the value it replaced are kept until the next
+// save of key, so Load and LoadRaw, which fetch every chunk before
+// returning, see either the old value or the new one.  LoadStream
+// fetches chunks as they are read, so a stream can fail if key is
+// saved twice while it is being read.  Chunks are hidden from Keys.
+var ConsulChunkSize = 512 * 1024
+
+// consulChunkFlag is set in the Flags of a manifest, which holds the
+// gen of its chunks and how many there are, separated by a /.
+const consulChunkFlag = 0x44525343
+
+const consulChunkDir = "._chunks/"
+
+func (b *Consul) chunkPrefix(key, gen string) string {
+	return b.finalKey(consulChunkDir+key+"/"+gen) + "/"
+}
+
+func (b *Consul) chunkKey(key, gen string, n int) string {
+	return fmt.Sprintf("%s%08d", b.chunkPrefix(key, gen), n)
+}
+
+// consulManifest returns the gen and count of the chunks kp refers to,
+// or false if kp holds a value that is not chunked.
+func consulManifest(kp *consul.KVPair) (string, int, bool, error) {
+	if kp.Flags != consulChunkFlag {
+		return "", 0, false, nil
+	}
+	parts := strings.SplitN(string(kp.Value), "/", 2)
+	if len(parts) != 2 {
+		return "", 0, true, fmt.Errorf("Invalid chunk manifest for %s", kp.Key)
+	}
+	count, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, true, fmt.Errorf("Invalid chunk manifest for %s", kp.Key)
+	}
+	return parts[0], count, true, nil
+}
+
+// SaveStream saves r as key.  r is read one chunk at a time, so only
+// a single chunk is held in memory.  If r fails, the value of key is
+// left as it was.
+func (b *Consul) SaveStream(key string, r io.Reader) error {
+	_, err := b.saveStream(key, r, nil)
 	return err
 }
 
+// SaveETag saves val as key only if the ETag of key is still etag,
+// which is usually the ETag returned by LoadETag.  An empty etag means
+// that key must not exist yet.  It returns the new ETag of key, or
+// StaleRevision if key was changed in the meantime.
+func (b *Consul) SaveETag(key string, val interface{}, etag string) (string, error) {
+	var index uint64
+	if etag != "" {
+		var err error
+		if index, err = strconv.ParseUint(etag, 10, 64); err != nil || index == 0 {
+			return "", StaleRevision(key)
+		}
+	}
+	buf, err := b.Encode(val)
+	if err != nil {
+		return "", err
+	}
+	return b.saveStream(key, bytes.NewReader(buf), &index)
+}
+
+// saveStream saves r as key.  If index is not nil, key is only saved
+// if its ModifyIndex is still *index, where 0 means that key must not
+// exist yet.  It returns the ETag of the saved value.
+func (b *Consul) saveStream(key string, r io.Reader, index *uint64) (string, error) {
+	b.panicIfClosed()
+	if b.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	kv := b.Client.KV()
+	genBuf := make([]byte, 8)
+	if _, err := rand.Read(genBuf); err != nil {
+		return "", err
+	}
+	gen := hex.EncodeToString(genBuf)
+	discard := func() {
+		kv.DeleteTree(b.chunkPrefix(key, gen), nil)
+	}
+	kp := &consul.KVPair{Key: b.finalKey(key)}
+	chunk := make([]byte, ConsulChunkSize)
+	count := 0
+	for {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			discard()
+			return "", err
+		}
+		done := err != nil
+		if count == 0 && done {
+			// Small enough to save as is.
+			kp.Value = append([]byte{}, chunk[:n]...)
+			break
+		}
+		if n > 0 {
+			ckp := &consul.KVPair{Value: append([]byte{}, chunk[:n]...), Key: b.chunkKey(key, gen, count)}
+			if _, err := kv.Put(ckp, nil); err != nil {
+				discard()
+				return "", err
+			}
+			count++
+		}
+		if done {
+			kp.Value, kp.Flags = []byte(fmt.Sprintf("%s/%d", gen, count)), consulChunkFlag
+			break
+		}
+	}
+	etag, err := b.swap(key, kp, index)
+	if err != nil {
+		discard()
+		return "", err
+	}
+	return etag, nil
+}
+
+// swap replaces the value of key with kp using a check-and-set, and
+// then deletes the chunks of any values older than the one it
+// replaced.  If index is nil, it tries again if another client changes
+// key first.  Otherwise the check-and-set uses *index, and swap returns
+// StaleRevision if it fails.  It returns the ETag of kp.
+func (b *Consul) swap(key string, kp *consul.KVPair, index *uint64) (string, error) {
+	kv := b.Client.KV()
+	for {
+		old, _, err := kv.Get(kp.Key, nil)
+		if err != nil {
+			return "", err
+		}
+		kp.ModifyIndex = 0
+		if old != nil {
+			kp.ModifyIndex = old.ModifyIndex
+		}
+		if index != nil && kp.ModifyIndex != *index {
+			return "", StaleRevision(key)
+		}
+		ok, _, err := kv.CAS(kp, nil)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			if index != nil {
+				return "", StaleRevision(key)
+			}
+			continue
+		}
+		keep := map[string]bool{}
+		for _, m := range []*consul.KVPair{old, kp} {
+			if m == nil {
+				continue
+			}
+			if gen, _, chunked, err := consulManifest(m); chunked && err == nil {
+				keep[gen] = true
+			}
+		}
+		// kp is saved now, so chunks that cannot be dropped are left
+		// for the next save to drop.
+		b.dropChunks(key, keep)
+		return b.etagOf(kp), nil
+	}
+}
+
+// etagOf returns the ETag of kp, which has just been saved.  If key
+// cannot be fetched or was changed again since, the ETag is one that
+// will not match it.
+func (b *Consul) etagOf(kp *consul.KVPair) string {
+	now, _, err := b.Client.KV().Get(kp.Key, nil)
+	if err != nil || now == nil || now.Flags != kp.Flags || !bytes.Equal(now.Value, kp.Value) {
+		return strconv.FormatUint(kp.ModifyIndex, 10)
+	}
+	return strconv.FormatUint(now.ModifyIndex, 10)
+}
+
+// dropChunks deletes the chunks saved for key, other than those of the
+// gens in keep.
+func (b *Consul) dropChunks(key string, keep map[string]bool) error {
+	kv := b.Client.KV()
+	dir := b.finalKey(consulChunkDir+key) + "/"
+	keys, _, err := kv.Keys(dir, "/", nil)
+	if err != nil {
+		return err
+	}
+	dropped := map[string]bool{}
+	for _, k := range keys {
+		gen := strings.SplitN(strings.TrimPrefix(k, dir), "/", 2)[0]
+		if keep[gen] || dropped[gen] {
+			continue
+		}
+		dropped[gen] = true
+		if _, err := kv.DeleteTree(b.chunkPrefix(key, gen), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consulChunkReader reads the chunks of a chunked value one at a time.
+type consulChunkReader struct {
+	b           *Consul
+	key, gen    string
+	next, count int
+	cur         *bytes.Reader
+}
+
+func (c *consulChunkReader) Read(p []byte) (int, error) {
+	for c.cur == nil || c.cur.Len() == 0 {
+		if c.next == c.count {
+			return 0, io.EOF
+		}
+		kp, _, err := c.b.Client.KV().Get(c.b.chunkKey(c.key, c.gen, c.next), nil)
+		if err != nil {
+			return 0, err
+		}
+		if kp == nil {
+			return 0, fmt.Errorf("Chunk %d of %s is missing", c.next, c.key)
+		}
+		c.cur = bytes.NewReader(kp.Value)
+		c.next++
+	}
+	return c.cur.Read(p)
+}
+
+func (c *consulChunkReader) Close() error {
+	return nil
+}
+
+func (b *Consul) LoadStream(key string) (io.ReadCloser, error) {
+	b.panicIfClosed()
+	kp, _, err := b.Client.KV().Get(b.finalKey(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if kp == nil {
+		return nil, os.ErrNotExist
+	}
+	gen, count, chunked, err := consulManifest(kp)
+	if err != nil {
+		return nil, err
+	}
+	if !chunked {
+		return ioutil.NopCloser(bytes.NewReader(kp.Value)), nil
+	}
+	return &consulChunkReader{b: b, key: key, gen: gen, count: count}, nil
+}
+
 func (b *Consul) Remove(key string) error {
 	b.panicIfClosed()
 	if b.ReadOnly() {
 		return UnWritable(key)
 	}
-	_, err := b.Client.KV().Delete(b.finalKey(key), nil)
-	return err
+	if _, err := b.Client.KV().Delete(b.finalKey(key), nil); err != nil {
+		return err
+	}
+	return b.dropChunks(key, nil)
 }
 
 func (b *Consul) MetaData() (res map[string]string) {
@@ -0,0 +1,243 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	consul "github.com/hashicorp/consul/api"
+)
+
+// fakeConsul serves the parts of the Consul KV HTTP API that the Consul
+// Store uses.
+type fakeConsul struct {
+	mux   sync.Mutex
+	index uint64
+	kv    map[string]*consul.KVPair
+	// beforeList is called, if set, before a recursive GET is served.
+	beforeList func()
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	q := r.URL.Query()
+	if _, recurse := q["recurse"]; recurse && r.Method == "GET" && f.beforeList != nil {
+		f.beforeList()
+	}
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+	switch r.Method {
+	case "GET":
+		if _, ok := q["keys"]; ok {
+			keys := []string{}
+			for k := range f.kv {
+				if strings.HasPrefix(k, key) {
+					keys = append(keys, k)
+				}
+			}
+			if len(keys) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			sort.Strings(keys)
+			json.NewEncoder(w).Encode(keys)
+			return
+		}
+		if _, ok := q["recurse"]; ok {
+			kps := []*consul.KVPair{}
+			for k, kp := range f.kv {
+				if strings.HasPrefix(k, key) {
+					kps = append(kps, kp)
+				}
+			}
+			if len(kps) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(kps)
+			return
+		}
+		kp, ok := f.kv[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode([]*consul.KVPair{kp})
+	case "PUT":
+		body, _ := ioutil.ReadAll(r.Body)
+		flags, _ := strconv.ParseUint(q.Get("flags"), 10, 64)
+		if cas := q.Get("cas"); cas != "" {
+			idx, _ := strconv.ParseUint(cas, 10, 64)
+			old, ok := f.kv[key]
+			if (idx == 0 && ok) || (idx != 0 && (!ok || old.ModifyIndex != idx)) {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		f.index++
+		f.kv[key] = &consul.KVPair{Key: key, Value: body, Flags: flags, ModifyIndex: f.index}
+		w.Write([]byte("true"))
+	case "DELETE":
+		_, recurse := q["recurse"]
+		for k := range f.kv {
+			if k == key || (recurse && strings.HasPrefix(k, key)) {
+				delete(f.kv, k)
+			}
+		}
+		f.index++
+		w.Write([]byte("true"))
+	}
+}
+
+func (f *fakeConsul) chunks() int {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	res := 0
+	for k := range f.kv {
+		if strings.Contains(k, consulChunkDir) {
+			res++
+		}
+	}
+	return res
+}
+
+func openFakeConsul(t *testing.T) (*Consul, *fakeConsul, func()) {
+	fake := &fakeConsul{kv: map[string]*consul.KVPair{}}
+	srv := httptest.NewServer(fake)
+	client, err := consul.NewClient(&consul.Config{Address: srv.Listener.Addr().String()})
+	if err != nil {
+		t.Fatalf("Failed to create Consul client: %v", err)
+	}
+	c := &Consul{Client: client, BaseKey: "test"}
+	if err := c.Open(nil); err != nil {
+		t.Fatalf("Failed to open Consul store: %v", err)
+	}
+	return c, fake, srv.Close
+}
+
+func TestConsulStore(t *testing.T) {
+	c, _, done := openFakeConsul(t)
+	defer done()
+	runTests(t, c, createTests)
+	if err := c.Save("test", &TestVal{Name: "test"}); err != nil {
+		t.Fatalf("Failed to save test: %v", err)
+	}
+	val := &TestVal{}
+	if err := c.Load("test", val); err != nil || val.Name != "test" {
+		t.Errorf("Failed to load test: %v, %v", val, err)
+	}
+	if err := c.Remove("test"); err != nil {
+		t.Errorf("Failed to remove test: %v", err)
+	}
+	if err := c.Remove("test"); err != nil {
+		t.Errorf("Expected removing a missing key to succeed, got %v", err)
+	}
+	if err := c.Load("test", val); !os.IsNotExist(err) {
+		t.Errorf("Expected test to be removed, got %v", err)
+	}
+	sub, err := c.MakeSub("sub")
+	if err != nil {
+		t.Fatalf("Failed to make substore: %v", err)
+	}
+	runTests(t, sub, createTests)
+	testETagStore(t, c)
+}
+
+func TestConsulChunks(t *testing.T) {
+	c, fake, done := openFakeConsul(t)
+	defer done()
+	defer func(size int) { ConsulChunkSize = size }(ConsulChunkSize)
+	ConsulChunkSize = 16
+
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 10)
+	if err := c.SaveRaw("blob", blob); err != nil {
+		t.Fatalf("Failed to save chunked value: %v", err)
+	}
+	if fake.chunks() != 10 {
+		t.Errorf("Expected 10 chunks, got %d", fake.chunks())
+	}
+	if err := c.SaveStream("blob", &failingReader{bytes.NewReader(bytes.Repeat([]byte("x"), 40))}); err == nil {
+		t.Errorf("Expected a failing stream to fail to save")
+	}
+	if buf, err := c.LoadRaw("blob"); err != nil || !bytes.Equal(buf, blob) {
+		t.Errorf("Expected a failed save to leave the value alone: %v, %q", err, buf)
+	}
+	if fake.chunks() != 10 {
+		t.Errorf("Expected the chunks of a failed save to be removed, have %d", fake.chunks())
+	}
+	smaller := blob[:40]
+	if err := c.SaveRaw("blob", smaller); err != nil {
+		t.Fatalf("Failed to save chunked value: %v", err)
+	}
+	if buf, _ := c.LoadRaw("blob"); !bytes.Equal(buf, smaller) {
+		t.Errorf("Expected %q, got %q", smaller, buf)
+	}
+	if fake.chunks() != 13 {
+		t.Errorf("Expected the replaced chunks to be kept, have %d", fake.chunks())
+	}
+	if err := c.SaveRaw("blob", smaller); err != nil {
+		t.Fatalf("Failed to save chunked value: %v", err)
+	}
+	if fake.chunks() != 6 {
+		t.Errorf("Expected older chunks to be removed by the next save, have %d", fake.chunks())
+	}
+	lookalike := []byte("abcd/3")
+	if err := c.SaveRaw("small", lookalike); err != nil {
+		t.Fatalf("Failed to save small value: %v", err)
+	}
+	if buf, err := c.LoadRaw("small"); err != nil || !bytes.Equal(buf, lookalike) {
+		t.Errorf("Expected a small value to load as is: %v, %q", err, buf)
+	}
+	if keys, _ := c.Keys(); len(keys) != 2 {
+		t.Errorf("Expected chunks to be hidden from Keys, got %v", keys)
+	}
+	if err := c.Remove("blob"); err != nil {
+		t.Errorf("Failed to remove chunked value: %v", err)
+	}
+	if fake.chunks() != 0 {
+		t.Errorf("Expected removing the value to remove its chunks, have %d", fake.chunks())
+	}
+	// Values saved with SaveETag are chunked as well.
+	testETagStore(t, c)
+	if fake.chunks() == 0 {
+		t.Errorf("Expected values saved with SaveETag to be chunked")
+	}
+}
+
+func TestConsulLoadDuringSave(t *testing.T) {
+	c, fake, done := openFakeConsul(t)
+	defer done()
+	defer func(size int) { ConsulChunkSize = size }(ConsulChunkSize)
+	ConsulChunkSize = 16
+
+	old := bytes.Repeat([]byte("o"), 100)
+	c.SaveRaw("blob", old)
+	newer := bytes.Repeat([]byte("n"), 50)
+	newest := bytes.Repeat([]byte("x"), 70)
+	saves := [][]byte{newer}
+	fake.beforeList = func() {
+		for len(saves) > 0 {
+			buf := saves[0]
+			saves = saves[1:]
+			if err := c.SaveRaw("blob", buf); err != nil {
+				t.Errorf("Failed to save during a load: %v", err)
+			}
+		}
+	}
+	if buf, err := c.LoadRaw("blob"); err != nil || !bytes.Equal(buf, old) {
+		t.Errorf("Expected a load overlapping a save to see the old value: %v, %q", err, buf)
+	}
+	saves = [][]byte{newest, newer}
+	if buf, err := c.LoadRaw("blob"); err != nil || !bytes.Equal(buf, newer) {
+		t.Errorf("Expected a load overlapping two saves to see the newest value: %v, %q", err, buf)
+	}
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/url"
 	"os"
@@ -11,19 +12,93 @@ import (
 )
 
 // Directory implements a Store that is backed by a local directory tree.
+//
+// Normally a Directory only sees files with the extension of its
+// Codec.  If Mixed is set, files with the extension of any registered
+// Codec are loaded with that Codec (the Directory's own Codec is used
+// for its own extension), and saving an existing key keeps it in the
+// format it is already in.  New keys are saved with the Directory's
+// Codec.  A key stored in more than one format is a DuplicateKey
+// error.
 type Directory struct {
 	storeBase
-	Path string
+	Path  string
+	Mixed bool
+}
+
+// DuplicateKey is the error returned by a Mixed Directory when a key
+// is stored in more than one format.
+type DuplicateKey string
+
+func (d DuplicateKey) Error() string {
+	return fmt.Sprintf("key %s: stored in more than one format", string(d))
 }
 
 func (d *Directory) Type() string {
 	return "directory"
 }
 
+// metaFile returns the name of the file the metadata value k is kept
+// in at the top of a Directory.  Stores that use the Directory layout
+// keep their metadata the same way.
+func metaFile(k string) string {
+	return url.QueryEscape("._" + k + ".meta")
+}
+
+// metaKey returns the metadata key kept in the file called name, or
+// false if name does not hold metadata.
+func metaKey(name string) (string, bool) {
+	name, err := url.QueryUnescape(name)
+	if err != nil || !strings.HasPrefix(name, "._") || !strings.HasSuffix(name, ".meta") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(name, "._"), ".meta"), true
+}
+
 func (f *Directory) filename(n string) string {
 	return filepath.Join(f.Path, url.QueryEscape(n))
 }
 
+// codecs returns the Codecs the Directory reads, indexed by file
+// extension.
+func (f *Directory) codecs() map[string]Codec {
+	if !f.Mixed {
+		return map[string]Codec{f.Ext(): f.Codec}
+	}
+	res := codecsByExt()
+	res[f.Ext()] = f.Codec
+	return res
+}
+
+// locate returns the name of the file key is stored in and the Codec
+// for it.  Keys that do not exist yet belong in a file with the
+// Directory's extension.
+func (f *Directory) locate(key string) (string, Codec, error) {
+	fileName, codec := f.filename(key+f.Ext()), f.Codec
+	if !f.Mixed {
+		return fileName, codec, nil
+	}
+	found := false
+	for ext, c := range f.codecs() {
+		candidate := f.filename(key + ext)
+		if _, err := os.Stat(candidate); err != nil {
+			continue
+		}
+		if found {
+			return "", nil, DuplicateKey(filepath.Join(f.Path, key))
+		}
+		fileName, codec, found = candidate, c, true
+	}
+	return fileName, codec, nil
+}
+
+func (f *Directory) codecOf(key string) Codec {
+	if _, codec, err := f.locate(key); err == nil {
+		return codec
+	}
+	return f.Codec
+}
+
 func (d *Directory) MetaData() (res map[string]string) {
 	d.RLock()
 	defer d.RUnlock()
@@ -45,14 +120,10 @@ func (d *Directory) MetaData() (res map[string]string) {
 			continue
 		}
 		name := info.Name()
-		if !(strings.HasPrefix(name, "._") && strings.HasSuffix(name, ".meta")) {
+		key, ok := metaKey(name)
+		if !ok {
 			continue
 		}
-		key, err := url.QueryUnescape(name)
-		if err != nil {
-			continue
-		}
-		key = strings.TrimSuffix(strings.TrimPrefix(key, "._"), ".meta")
 		buf, err := ioutil.ReadFile(path.Join(d.Path, name))
 		if err != nil {
 			continue
@@ -74,11 +145,11 @@ func (d *Directory) SetMetaData(vals map[string]string) error {
 	}
 	written := map[string]struct{}{}
 	for k, v := range vals {
-		fileName := d.filename("._" + k + ".meta")
+		fileName := filepath.Join(d.Path, metaFile(k))
 		if err := ioutil.WriteFile(fileName, []byte(v), 0644); err != nil {
 			panic(err.Error())
 		}
-		written[path.Base(d.filename("._"+k+".meta"))] = struct{}{}
+		written[metaFile(k)] = struct{}{}
 	}
 	// Clean out the metadata values we no longer want
 	dir, err := os.Open(d.Path)
@@ -94,10 +165,14 @@ func (d *Directory) SetMetaData(vals map[string]string) error {
 		if info.IsDir() {
 			continue
 		}
-		if _, ok := written[info.Name()]; ok {
+		name := info.Name()
+		if _, ok := metaKey(name); !ok {
 			continue
 		}
-		os.Remove(path.Join(d.Path, info.Name()))
+		if _, ok := written[name]; ok {
+			continue
+		}
+		os.Remove(path.Join(d.Path, name))
 	}
 	if n, ok := vals["Name"]; ok {
 		d.name = n
@@ -151,7 +226,7 @@ func (f *Directory) MakeSub(path string) (Store, error) {
 	if child, ok := f.subStores[path]; ok {
 		return child, nil
 	}
-	child := &Directory{Path: filepath.Join(f.Path, path)}
+	child := &Directory{Path: filepath.Join(f.Path, path), Mixed: f.Mixed}
 	err := child.Open(f.Codec)
 	if err != nil {
 		return nil, err
@@ -171,19 +246,26 @@ func (f *Directory) Keys() ([]string, error) {
 	if err != nil {
 		return nil, fmt.Errorf("dir keys: readdir error %#v", err)
 	}
+	codecs := f.codecs()
+	seen := map[string]struct{}{}
 	res := []string{}
 	for _, info := range infos {
 		if info.IsDir() {
 			continue
 		}
 		name := info.Name()
-		if !strings.HasSuffix(name, f.Ext()) {
+		ext := filepath.Ext(name)
+		if _, ok := codecs[ext]; !ok {
 			continue
 		}
-		n, err := url.QueryUnescape(strings.TrimSuffix(name, f.Ext()))
+		n, err := url.QueryUnescape(strings.TrimSuffix(name, ext))
 		if err != nil {
 			return nil, err
 		}
+		if _, ok := seen[n]; ok {
+			return nil, DuplicateKey(filepath.Join(f.Path, n))
+		}
+		seen[n] = struct{}{}
 		res = append(res, n)
 	}
 	return res, nil
@@ -191,13 +273,17 @@ func (f *Directory) Keys() ([]string, error) {
 
 func (f *Directory) Load(key string, val interface{}) error {
 	f.panicIfClosed()
-	buf, err := ioutil.ReadFile(f.filename(key + f.Ext()))
+	fileName, codec, err := f.locate(key)
 	if err != nil {
 		return err
 	}
-	if err := f.Decode(buf, val); err != nil {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
 		return err
 	}
+	if err := codec.Decode(buf, val); err != nil {
+		return decodeError(fileName, key, err)
+	}
 	if ro, ok := val.(ReadOnlySetter); ok {
 		ro.SetReadOnly(f.ReadOnly())
 	}
@@ -210,16 +296,64 @@ func (f *Directory) Load(key string, val interface{}) error {
 	return nil
 }
 
+func (f *Directory) LoadRaw(key string) ([]byte, error) {
+	f.panicIfClosed()
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(fileName)
+}
+
+func (f *Directory) SaveRaw(key string, buf []byte) error {
+	f.panicIfClosed()
+	if f.ReadOnly() {
+		return UnWritable(key)
+	}
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return err
+	}
+	return safeReplace(fileName, buf)
+}
+
+// SaveStream writes r to a temporary file next to the one for key,
+// and renames it into place once all of r has been written.
+func (f *Directory) SaveStream(key string, r io.Reader) error {
+	f.panicIfClosed()
+	if f.ReadOnly() {
+		return UnWritable(key)
+	}
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return err
+	}
+	return safeReplaceFrom(fileName, r)
+}
+
+func (f *Directory) LoadStream(key string) (io.ReadCloser, error) {
+	f.panicIfClosed()
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fileName)
+}
+
 func (f *Directory) Save(key string, val interface{}) error {
 	f.panicIfClosed()
 	if f.ReadOnly() {
 		return UnWritable(key)
 	}
-	buf, err := f.Encode(val)
+	fileName, codec, err := f.locate(key)
+	if err != nil {
+		return err
+	}
+	buf, err := encodeOver(codec, fileName, val)
 	if err != nil {
 		return err
 	}
-	return safeReplace(f.filename(key+f.Ext()), buf)
+	return safeReplace(fileName, buf)
 }
 
 func (f *Directory) Remove(key string) error {
@@ -227,5 +361,9 @@ func (f *Directory) Remove(key string) error {
 	if f.ReadOnly() {
 		return UnWritable(key)
 	}
-	return os.Remove(f.filename(key + f.Ext()))
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(fileName)
 }
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestMixedDirectory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	files := map[string]string{
+		"a.json":   `{"Name":"a","Val":"json"}`,
+		"b.yaml":   "Name: b\nVal: yaml\n",
+		"c.toml":   "Name = 'c'\nVal = 'toml'\n",
+		"notes.md": "not an object",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(path.Join(tmpDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	plain, _ := Open("directory:" + tmpDir)
+	if keys, _ := plain.Keys(); len(keys) != 1 {
+		t.Errorf("Expected a plain directory to see only a, not %v", keys)
+	}
+	s, err := Open("directory:" + tmpDir + "?mixed=true")
+	if err != nil {
+		t.Fatalf("Failed to open mixed directory: %v", err)
+	}
+	keys, err := s.Keys()
+	if err != nil {
+		t.Fatalf("Failed to list keys: %v", err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, ",") != "a,b,c" {
+		t.Errorf("Expected keys a,b,c, not %v", keys)
+	}
+	for _, key := range keys {
+		val := &TestVal{}
+		if err := s.Load(key, val); err != nil {
+			t.Errorf("Failed to load %s: %v", key, err)
+		} else if val.Name != key {
+			t.Errorf("Loaded the wrong value for %s: %#v", key, val)
+		}
+		val.Val = "updated"
+		if err := s.Save(key, val); err != nil {
+			t.Errorf("Failed to save %s: %v", key, err)
+		}
+	}
+	if err := s.Save("d", &TestVal{Name: "d"}); err != nil {
+		t.Errorf("Failed to save d: %v", err)
+	}
+	for _, name := range []string{"a.json", "b.yaml", "c.toml", "d.json"} {
+		buf, err := ioutil.ReadFile(path.Join(tmpDir, name))
+		if err != nil {
+			t.Errorf("Expected %s to exist: %v", name, err)
+		} else if name != "d.json" && !strings.Contains(string(buf), "updated") {
+			t.Errorf("Expected %s to be updated in place, got %s", name, string(buf))
+		}
+	}
+	if keys, _ := s.Keys(); len(keys) != 4 {
+		t.Errorf("Expected 4 keys after saving, not %v", keys)
+	}
+
+	ioutil.WriteFile(path.Join(tmpDir, "a.yaml"), []byte("Name: a\n"), 0644)
+	if _, err := s.Keys(); err == nil {
+		t.Errorf("Expected duplicate keys to be an error")
+	} else if _, ok := err.(DuplicateKey); !ok {
+		t.Errorf("Expected DuplicateKey, got %v", err)
+	}
+	if err := s.Load("a", &TestVal{}); err == nil {
+		t.Errorf("Expected loading a duplicate key to fail")
+	}
+	if err := s.Remove("b"); err != nil {
+		t.Errorf("Failed to remove b: %v", err)
+	}
+	if _, err := os.Stat(path.Join(tmpDir, "b.yaml")); !os.IsNotExist(err) {
+		t.Errorf("Expected b.yaml to be removed")
+	}
+}
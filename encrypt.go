@@ -0,0 +1,258 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encMagic starts every value written by an encrypting Codec.
+var encMagic = []byte("DRSE\x01")
+
+// UnknownKey is the error returned when a value was encrypted with a
+// key that is not in the KeyRing.
+type UnknownKey string
+
+func (u UnknownKey) Error() string {
+	return fmt.Sprintf("encryption key %s: not found", string(u))
+}
+
+// KeyRing holds the AES keys used by an encrypting Codec, indexed by
+// key ID.  New values are always encrypted with the Primary key, and
+// any key in the KeyRing can be used to decrypt.
+type KeyRing struct {
+	sync.RWMutex
+	Primary string
+	keys    map[string][]byte
+}
+
+// Add adds an AES-128, AES-192, or AES-256 key to the KeyRing.  The
+// first key added becomes the Primary key.
+func (k *KeyRing) Add(id string, key []byte) error {
+	if id == "" || len(id) > 255 {
+		return fmt.Errorf("Invalid key ID %q", id)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+	default:
+		return fmt.Errorf("Key %s must be 16, 24, or 32 bytes long, not %d", id, len(key))
+	}
+	k.Lock()
+	defer k.Unlock()
+	if k.keys == nil {
+		k.keys = map[string][]byte{}
+	}
+	k.keys[id] = append([]byte{}, key...)
+	if k.Primary == "" {
+		k.Primary = id
+	}
+	return nil
+}
+
+// AddFile adds the key stored in fileName to the KeyRing.  The key ID
+// is the base name of the file without its extension, and the file
+// must contain either the raw key or the key encoded in base64.
+func (k *KeyRing) AddFile(fileName string) error {
+	buf, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	id := strings.TrimSuffix(filepath.Base(fileName), filepath.Ext(fileName))
+	key := buf
+	if decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(buf))); err == nil {
+		key = decoded
+	}
+	return k.Add(id, key)
+}
+
+func (k *KeyRing) aead(id string) (cipher.AEAD, error) {
+	k.RLock()
+	key, ok := k.keys[id]
+	k.RUnlock()
+	if !ok {
+		return nil, UnknownKey(id)
+	}
+	return newAEAD(key)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seal(aead cipher.AEAD, plain, extra []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, extra), nil
+}
+
+func unseal(aead cipher.AEAD, sealed, extra []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("Encrypted value is truncated")
+	}
+	n := aead.NonceSize()
+	return aead.Open(nil, sealed[:n], sealed[n:], extra)
+}
+
+type encryptingCodec struct {
+	inner Codec
+	keys  *KeyRing
+}
+
+// EncryptingCodec returns a Codec that encrypts values encoded by
+// inner using envelope encryption.  Each value is encrypted with
+// AES-GCM using a fresh data key, and the data key is encrypted with
+// the Primary key from keys.  The ID of the Primary key is stored
+// with the value, so values encrypted with an older key can be
+// decrypted as long as that key is still in keys.  Values that are
+// not encrypted are passed straight to inner, so existing plaintext
+// data can still be read.
+func EncryptingCodec(inner Codec, keys *KeyRing) Codec {
+	return &encryptingCodec{inner: inner, keys: keys}
+}
+
+func (e *encryptingCodec) Ext() string {
+	return e.inner.Ext()
+}
+
+func (e *encryptingCodec) viaJson() bool {
+	return isJsonBased(e.inner)
+}
+
+// The encrypted format is:
+//
+//	magic | len(keyID) | keyID | len(wrapped data key) | wrapped data key | sealed value
+//
+// with the key ID and magic authenticated as additional data.
+func (e *encryptingCodec) Encode(i interface{}) ([]byte, error) {
+	plain, err := e.inner.Encode(i)
+	if err != nil {
+		return nil, err
+	}
+	e.keys.RLock()
+	id := e.keys.Primary
+	e.keys.RUnlock()
+	kek, err := e.keys.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+	header := append(append(append([]byte{}, encMagic...), byte(len(id))), id...)
+	wrapped, err := seal(kek, dataKey, header)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := seal(dek, plain, header)
+	if err != nil {
+		return nil, err
+	}
+	res := append(header, byte(len(wrapped)))
+	res = append(res, wrapped...)
+	return append(res, sealed...), nil
+}
+
+func (e *encryptingCodec) decrypt(buf []byte) ([]byte, error) {
+	if !bytes.HasPrefix(buf, encMagic) {
+		return buf, nil
+	}
+	rest := buf[len(encMagic):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+1 {
+		return nil, fmt.Errorf("Encrypted value is truncated")
+	}
+	id := string(rest[1 : 1+int(rest[0])])
+	header := buf[:len(encMagic)+1+len(id)]
+	rest = rest[1+len(id):]
+	wrappedLen := int(rest[0])
+	rest = rest[1:]
+	if len(rest) < wrappedLen {
+		return nil, fmt.Errorf("Encrypted value is truncated")
+	}
+	kek, err := e.keys.aead(id)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := unseal(kek, rest[:wrappedLen], header)
+	if err != nil {
+		return nil, err
+	}
+	dek, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return unseal(dek, rest[wrappedLen:], header)
+}
+
+func (e *encryptingCodec) Decode(buf []byte, i interface{}) error {
+	plain, err := e.decrypt(buf)
+	if err != nil {
+		return err
+	}
+	return e.inner.Decode(plain, i)
+}
+
+// encrypts reports whether c is, or wraps, a Codec created by
+// EncryptingCodec.
+func encrypts(c Codec) bool {
+	for {
+		switch v := c.(type) {
+		case *encryptingCodec:
+			return true
+		case *strictCodec:
+			c = v.inner
+		case *compressingCodec:
+			c = v.inner
+		default:
+			return false
+		}
+	}
+}
+
+// Reencrypt rewrites every value in s and its substores, so that
+// everything is encrypted with the current Primary key.  s must use a
+// Codec created by EncryptingCodec, possibly wrapped by StrictCodec or
+// CompressingCodec.  Once Reencrypt finishes, keys
+// other than the Primary can be removed from the KeyRing.
+func Reencrypt(s Store) error {
+	if !encrypts(s.GetCodec()) {
+		return fmt.Errorf("Store %s does not use an encrypting codec", s.Name())
+	}
+	keys, err := s.Keys()
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		val, err := loadAny(s, key)
+		if err != nil {
+			return err
+		}
+		if err := s.Save(key, val); err != nil {
+			return err
+		}
+	}
+	for _, sub := range s.Subs() {
+		if err := Reencrypt(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func writeKey(t *testing.T, dir, name string) string {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	fileName := path.Join(dir, name+".key")
+	if err := ioutil.WriteFile(fileName, []byte(base64.StdEncoding.EncodeToString(key)), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return fileName
+}
+
+func TestEncryptedStores(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	oldKey := writeKey(t, tmpDir, "old")
+	newKey := writeKey(t, tmpDir, "new")
+	dataDir := path.Join(tmpDir, "data")
+	s, err := Open("directory:" + dataDir + "?keyfile=" + oldKey)
+	if err != nil {
+		t.Fatalf("Failed to open encrypted store: %v", err)
+	}
+	secret := &TestVal{Name: "secret", Val: "plaintext-password"}
+	if ok, err := Create(s, secret); !ok {
+		t.Fatalf("Failed to save secret: %v", err)
+	}
+	buf, err := ioutil.ReadFile(path.Join(dataDir, "secret.json"))
+	if err != nil {
+		t.Fatalf("Failed to read encrypted value: %v", err)
+	}
+	if bytes.Contains(buf, []byte("plaintext-password")) {
+		t.Errorf("Secret was saved in plaintext")
+	}
+	s.Close()
+
+	s, err = Open("directory:" + dataDir + "?keyfile=" + newKey + "&keyfile=" + oldKey)
+	if err != nil {
+		t.Fatalf("Failed to open rotated store: %v", err)
+	}
+	if err := Reencrypt(s); err != nil {
+		t.Fatalf("Failed to reencrypt store: %v", err)
+	}
+	s.Close()
+
+	s, err = Open("directory:" + dataDir + "?keyfile=" + newKey)
+	if err != nil {
+		t.Fatalf("Failed to open reencrypted store: %v", err)
+	}
+	loaded := &TestVal{Name: "secret"}
+	if ok, err := Load(s, loaded); !ok {
+		t.Errorf("Failed to load reencrypted secret: %v", err)
+	} else if loaded.Val != "plaintext-password" {
+		t.Errorf("Reencrypted secret has the wrong value %q", loaded.Val)
+	}
+	s.Close()
+
+	s, _ = Open("directory:" + dataDir + "?keyfile=" + oldKey)
+	if _, err := Load(s, &TestVal{Name: "secret"}); err == nil {
+		t.Errorf("Expected loading with the retired key to fail")
+	} else if _, ok := err.(UnknownKey); !ok {
+		t.Errorf("Expected UnknownKey, got %v", err)
+	}
+	s.Close()
+
+	fileStore := "file:" + path.Join(tmpDir, "data.json") + "?keyfile=" + newKey
+	s, err = Open(fileStore)
+	if err != nil {
+		t.Fatalf("Failed to open encrypted file store: %v", err)
+	}
+	testStore(t, s)
+}
+
+func TestReencryptWrappedCodec(t *testing.T) {
+	keys := &KeyRing{}
+	if err := keys.Add("old", make([]byte, 32)); err != nil {
+		t.Fatalf("Failed to add key: %v", err)
+	}
+	compressed, err := CompressingCodec(EncryptingCodec(DefaultCodec, keys), Gzip, 0)
+	if err != nil {
+		t.Fatalf("Failed to make compressing codec: %v", err)
+	}
+	for _, codec := range []Codec{StrictCodec(EncryptingCodec(DefaultCodec, keys)), compressed} {
+		s := &Memory{}
+		if err := s.Open(codec); err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		if err := s.Save("secret", &TestVal{Name: "secret", Val: "v"}); err != nil {
+			t.Fatalf("Failed to save secret: %v", err)
+		}
+		if err := Reencrypt(s); err != nil {
+			t.Errorf("Failed to reencrypt a store with a wrapped encrypting codec: %v", err)
+		}
+	}
+	s, _ := Open("memory:?strict=true")
+	if err := Reencrypt(s); err == nil {
+		t.Errorf("Expected reencrypting a store without an encrypting codec to fail")
+	}
+}
@@ -0,0 +1,390 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Etcd implements a Store that is backed by the etcd v3 key/value
+// store.  Keys are stored under BaseKey, and substores are stored
+// under sub-prefixes of it, each marked by an empty key ending in /
+// like Consul folders.  Metadata is kept in a hidden key, and is
+// shared by all the substores.
+type Etcd struct {
+	storeBase
+	Client *clientv3.Client
+	// Endpoints are the etcd servers to connect to if Client is nil.
+	Endpoints []string
+	// Timeout limits how long each request may take.  It defaults to
+	// 5 seconds.
+	Timeout time.Duration
+	BaseKey string
+}
+
+const etcdMetaKey = "._meta"
+
+func (e *Etcd) Type() string {
+	return "etcd"
+}
+
+func (e *Etcd) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), e.Timeout)
+}
+
+func (e *Etcd) finalKey(k string) string {
+	return path.Clean(path.Join(e.BaseKey, k))
+}
+
+func (e *Etcd) prefix() string {
+	return e.BaseKey + "/"
+}
+
+func (e *Etcd) Open(codec Codec) error {
+	if e.BaseKey == "" {
+		return fmt.Errorf("Cannot store data at an empty location in etcd!")
+	}
+	e.BaseKey = strings.Trim(e.BaseKey, "/")
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	e.Codec = codec
+	if e.Timeout == 0 {
+		e.Timeout = 5 * time.Second
+	}
+	if e.Client == nil {
+		if len(e.Endpoints) == 0 {
+			e.Endpoints = []string{"127.0.0.1:2379"}
+		}
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   e.Endpoints,
+			DialTimeout: e.Timeout,
+		})
+		if err != nil {
+			return err
+		}
+		e.Client = client
+		e.closer = func() {
+			e.Client.Close()
+			e.Client = nil
+		}
+	}
+	ctx, cancel := e.ctx()
+	defer cancel()
+	resp, err := e.Client.Get(ctx, e.prefix(), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return err
+	}
+	e.opened = true
+	subs := map[string]struct{}{}
+	for _, kv := range resp.Kvs {
+		rest := strings.TrimPrefix(string(kv.Key), e.prefix())
+		if i := strings.Index(rest, "/"); i > 0 {
+			subs[rest[:i]] = struct{}{}
+		}
+	}
+	for sub := range subs {
+		if _, err := e.openSub(sub); err != nil {
+			return err
+		}
+	}
+	md := e.MetaData()
+	if n, ok := md["Name"]; ok {
+		e.name = n
+	}
+	return nil
+}
+
+func (e *Etcd) MakeSub(prefix string) (Store, error) {
+	e.Lock()
+	defer e.Unlock()
+	e.panicIfClosed()
+	if res, ok := e.subStores[prefix]; ok {
+		return res, nil
+	}
+	if !e.readOnly {
+		ctx, cancel := e.ctx()
+		defer cancel()
+		if _, err := e.Client.Put(ctx, e.finalKey(prefix)+"/", ""); err != nil {
+			return nil, err
+		}
+	}
+	return e.openSub(prefix)
+}
+
+// openSub opens the existing substore prefix of e.
+func (e *Etcd) openSub(prefix string) (Store, error) {
+	res := &Etcd{Client: e.Client, Timeout: e.Timeout, BaseKey: e.finalKey(prefix)}
+	if err := res.Open(e.Codec); err != nil {
+		return nil, err
+	}
+	addSub(e, res, prefix)
+	return res, nil
+}
+
+// ownKey returns the key in e that etcdKey refers to, if it refers
+// to a value directly in e rather than a substore or metadata.
+func (e *Etcd) ownKey(etcdKey string) (string, bool) {
+	if !strings.HasPrefix(etcdKey, e.prefix()) {
+		return "", false
+	}
+	key := strings.TrimPrefix(etcdKey, e.prefix())
+	if key == "" || key == etcdMetaKey || strings.Contains(key, "/") {
+		return "", false
+	}
+	return key, true
+}
+
+func (e *Etcd) Keys() ([]string, error) {
+	e.panicIfClosed()
+	ctx, cancel := e.ctx()
+	defer cancel()
+	resp, err := e.Client.Get(ctx, e.prefix(), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, kv := range resp.Kvs {
+		if key, ok := e.ownKey(string(kv.Key)); ok {
+			res = append(res, key)
+		}
+	}
+	return res, nil
+}
+
+// loadRaw returns the raw value of key and the revision it was last
+// modified at.
+func (e *Etcd) loadRaw(key string) ([]byte, int64, error) {
+	e.panicIfClosed()
+	ctx, cancel := e.ctx()
+	defer cancel()
+	resp, err := e.Client.Get(ctx, e.finalKey(key))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, 0, os.ErrNotExist
+	}
+	return resp.Kvs[0].Value, resp.Kvs[0].ModRevision, nil
+}
+
+func (e *Etcd) LoadRaw(key string) ([]byte, error) {
+	buf, _, err := e.loadRaw(key)
+	return buf, err
+}
+
+func (e *Etcd) decode(key string, buf []byte, val interface{}) error {
+	if err := e.Decode(buf, val); err != nil {
+		return decodeError(e.finalKey(key), key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(e.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := e.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (e *Etcd) Load(key string, val interface{}) error {
+	_, err := e.LoadRev(key, val)
+	return err
+}
+
+// LoadRev is Load, and also returns the revision key was last
+// modified at for use with SaveRev.
+func (e *Etcd) LoadRev(key string, val interface{}) (int64, error) {
+	buf, rev, err := e.loadRaw(key)
+	if err != nil {
+		return 0, err
+	}
+	return rev, e.decode(key, buf, val)
+}
+
+func (e *Etcd) SaveRaw(key string, buf []byte) error {
+	e.panicIfClosed()
+	if e.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx, cancel := e.ctx()
+	defer cancel()
+	_, err := e.Client.Put(ctx, e.finalKey(key), string(buf))
+	return err
+}
+
+func (e *Etcd) Save(key string, val interface{}) error {
+	e.panicIfClosed()
+	if e.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := e.Encode(val)
+	if err != nil {
+		return err
+	}
+	return e.SaveRaw(key, buf)
+}
+
+// SaveRev saves val as key only if key has not been modified since
+// rev, which is usually the revision returned by LoadRev.  A rev of 0
+// means that key must not exist yet.  It returns the new revision of
+// key, or StaleRevision if key was changed in the meantime.
+func (e *Etcd) SaveRev(key string, val interface{}, rev int64) (int64, error) {
+	e.panicIfClosed()
+	if e.ReadOnly() {
+		return 0, UnWritable(key)
+	}
+	buf, err := e.Encode(val)
+	if err != nil {
+		return 0, err
+	}
+	ctx, cancel := e.ctx()
+	defer cancel()
+	k := e.finalKey(key)
+	resp, err := e.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(k), "=", rev)).
+		Then(clientv3.OpPut(k, string(buf))).
+		Commit()
+	if err != nil {
+		return 0, err
+	}
+	if !resp.Succeeded {
+		return 0, StaleRevision(key)
+	}
+	return resp.Header.Revision, nil
+}
+
+// LoadETag is LoadRev with the revision as a string, so that Etcd is
+// an ETagStore.  Like every ETagStore, an empty ETag stands for a key
+// that does not exist yet, rather than revision 0.
+func (e *Etcd) LoadETag(key string, val interface{}) (string, error) {
+	rev, err := e.LoadRev(key, val)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(rev, 10), nil
+}
+
+// SaveETag is SaveRev with the revision as a string.  An etag that is
+// not a revision LoadETag could have returned never matches.
+func (e *Etcd) SaveETag(key string, val interface{}, etag string) (string, error) {
+	rev := int64(0)
+	if etag != "" {
+		var err error
+		if rev, err = strconv.ParseInt(etag, 10, 64); err != nil || rev <= 0 {
+			return "", StaleRevision(key)
+		}
+	}
+	rev, err := e.SaveRev(key, val, rev)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(rev, 10), nil
+}
+
+// SaveStream reads all of r into memory and saves it as key.  etcd
+// limits values to 1.5 MiB by default.
+func (e *Etcd) SaveStream(key string, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return e.SaveRaw(key, buf)
+}
+
+func (e *Etcd) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := e.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (e *Etcd) Remove(key string) error {
+	e.panicIfClosed()
+	if e.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx, cancel := e.ctx()
+	defer cancel()
+	resp, err := e.Client.Delete(ctx, e.finalKey(key))
+	if err != nil {
+		return err
+	}
+	if resp.Deleted == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
+
+// Watch calls fn for every key saved to or removed from e, by this or
+// any other client, until cancel is called.  If the watch is lost, fn
+// is called with an OpLost Event.
+func (e *Etcd) Watch(fn func(Event)) (func(), error) {
+	e.panicIfClosed()
+	ctx, cancel := context.WithCancel(clientv3.WithRequireLeader(context.Background()))
+	ch := e.Client.Watch(ctx, e.prefix(), clientv3.WithPrefix())
+	go func() {
+		for resp := range ch {
+			if resp.Canceled {
+				break
+			}
+			for _, ev := range resp.Events {
+				key, ok := e.ownKey(string(ev.Kv.Key))
+				if !ok {
+					continue
+				}
+				op := OpSave
+				if ev.Type == clientv3.EventTypeDelete {
+					op = OpRemove
+				}
+				fn(Event{Key: key, Op: op})
+			}
+		}
+		if ctx.Err() == nil {
+			// The watch was lost, so anything may have changed.
+			fn(Event{Op: OpLost})
+		}
+	}()
+	return cancel, nil
+}
+
+func (e *Etcd) MetaData() map[string]string {
+	if e.parentStore != nil {
+		return e.parentStore.(*Etcd).MetaData()
+	}
+	res := map[string]string{}
+	e.Load(etcdMetaKey, &res)
+	return res
+}
+
+func (e *Etcd) SetMetaData(vals map[string]string) error {
+	if e.parentStore != nil {
+		return e.parentStore.(*Etcd).SetMetaData(vals)
+	}
+	if e.ReadOnly() {
+		return UnWritable("metadata")
+	}
+	if n, ok := vals["Name"]; ok {
+		e.name = n
+	}
+	buf, err := e.Encode(vals)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := e.ctx()
+	defer cancel()
+	_, err = e.Client.Put(ctx, e.finalKey(etcdMetaKey), string(buf))
+	return err
+}
@@ -0,0 +1,151 @@
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func startEtcd(t *testing.T, dir string) (*embed.Etcd, string) {
+	cfg := embed.NewConfig()
+	cfg.Dir = dir
+	cfg.LogLevel = "error"
+	client, peer := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls = []url.URL{client}
+	cfg.AdvertiseClientUrls = []url.URL{client}
+	cfg.ListenPeerUrls = []url.URL{peer}
+	cfg.AdvertisePeerUrls = []url.URL{peer}
+	cfg.InitialCluster = cfg.Name + "=" + peer.String()
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatalf("Failed to start etcd: %v", err)
+	}
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		t.Fatalf("etcd took too long to start")
+	}
+	return e, client.Host
+}
+
+func TestEtcdStore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	server, host := startEtcd(t, tmpDir)
+	defer server.Close()
+
+	loc := "etcd://" + host + "/digitalrebar/test"
+	s, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open etcd store: %v", err)
+	}
+	if err := s.(MetaSaver).SetMetaData(map[string]string{"Name": "etcd"}); err != nil {
+		t.Errorf("Failed to set metadata: %v", err)
+	}
+	testStore(t, s)
+	s.Close()
+
+	s, err = Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to reopen etcd store: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "etcd" {
+		t.Errorf("Metadata did not persist")
+	}
+	if s.GetSub("sub1") == nil || s.GetSub("sub1").GetSub("sub2") == nil {
+		t.Errorf("Substores did not persist")
+	}
+	keys, _ := s.Keys()
+	sort.Strings(keys)
+	for _, key := range keys {
+		if strings.Contains(key, "/") || strings.HasPrefix(key, "._") {
+			t.Errorf("Keys returned a substore or metadata key %s", key)
+		}
+	}
+
+	e := s.(*Etcd)
+	revision := func() int64 {
+		resp, err := e.Client.Get(context.Background(), "rev")
+		if err != nil {
+			t.Fatalf("Failed to get revision: %v", err)
+		}
+		return resp.Header.Revision
+	}
+	before := revision()
+	ro, err := Open(loc + "?ro=true")
+	if err != nil {
+		t.Fatalf("Failed to open read-only etcd store: %v", err)
+	}
+	if after := revision(); after != before {
+		t.Errorf("Expected opening a store not to write to it, revision went from %d to %d", before, after)
+	}
+	if err := ro.(MetaSaver).SetMetaData(map[string]string{"Name": "ro"}); err != UnWritable("metadata") {
+		t.Errorf("Expected setting metadata on a read-only store to fail, got %v", err)
+	}
+	ro.Close()
+
+	events := make(chan Event, 10)
+	cancel, err := e.Watch(func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer cancel()
+
+	testETagStore(t, e)
+	for _, etag := range []string{"0", "-1", "bogus"} {
+		if _, err := e.SaveETag("cas", &TestVal{Name: "bogus"}, etag); err != StaleRevision("cas") {
+			t.Errorf("Expected StaleRevision saving with ETag %q, got %v", etag, err)
+		}
+	}
+
+	// Changes made by another client are reported.
+	other, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open second client: %v", err)
+	}
+	defer other.Close()
+	other.Remove("cas")
+	seen := map[Op]int{}
+	timeout := time.After(10 * time.Second)
+	for seen[OpRemove] == 0 {
+		select {
+		case ev := <-events:
+			if ev.Key != "cas" {
+				t.Errorf("Unexpected watch event %#v", ev)
+			}
+			seen[ev.Op]++
+		case <-timeout:
+			t.Fatalf("Timed out waiting for watch events, saw %v", seen)
+		}
+	}
+	if seen[OpSave] != 2 {
+		t.Errorf("Expected 2 save events, saw %v", seen)
+	}
+
+	other.SetReadOnly()
+	if err := other.Save("ro", &TestVal{}); err == nil {
+		t.Errorf("Expected saving to a read-only store to fail")
+	}
+}
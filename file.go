@@ -78,6 +78,14 @@ func (f *File) mux() *sync.RWMutex {
 	return &f.RWMutex
 }
 
+// root returns the File that holds the data for f and its parents.
+func (f *File) root() *File {
+	if f.parentStore != nil {
+		return f.parentStore.(*File).root()
+	}
+	return f
+}
+
 func (f *File) open(vals map[string]interface{}) error {
 	f.vals = map[string][]byte{}
 	f.meta = map[string]string{}
@@ -135,6 +143,9 @@ func (f *File) Open(codec Codec) error {
 	if codec == nil {
 		codec = DefaultCodec
 	}
+	if isGob(codec) {
+		return fmt.Errorf("Cannot use the gob codec for a file store, which must decode values without knowing their type")
+	}
 	f.Codec = codec
 	vals := map[string]interface{}{}
 	if err := os.MkdirAll(path.Dir(fullPath), 0755); err != nil {
@@ -146,9 +157,16 @@ func (f *File) Open(codec Codec) error {
 		return err
 	}
 	if buf != nil {
-		if err := f.Decode(buf, &vals); err != nil {
+		decoded, err := decodeAny(f.Codec, buf)
+		if err != nil {
 			return err
 		}
+		if decoded != nil {
+			var ok bool
+			if vals, ok = decoded.(map[string]interface{}); !ok {
+				return fmt.Errorf("Invalid file contents in %s", f.Path)
+			}
+		}
 	}
 	return f.open(vals)
 }
@@ -173,7 +191,7 @@ func (f *File) Load(key string, val interface{}) error {
 	buf, ok := f.vals[key]
 	if ok {
 		if err := f.Decode(buf, val); err != nil {
-			return err
+			return decodeError(f.root().Path, key, err)
 		}
 		if ro, ok := val.(ReadOnlySetter); ok {
 			ro.SetReadOnly(f.ReadOnly())
@@ -192,8 +210,8 @@ func (f *File) Load(key string, val interface{}) error {
 func (f *File) prepSave() (map[string]interface{}, error) {
 	res := map[string]interface{}{}
 	for k, v := range f.vals {
-		var obj interface{}
-		if err := f.Decode(v, &obj); err != nil {
+		obj, err := decodeAny(f.Codec, v)
+		if err != nil {
 			return nil, err
 		}
 		res[k] = obj
@@ -225,7 +243,7 @@ func (f *File) save() error {
 	if err != nil {
 		return err
 	}
-	buf, err := f.Encode(toSave)
+	buf, err := encodeOver(f.Codec, f.Path, toSave)
 	if err != nil {
 		return err
 	}
@@ -247,6 +265,42 @@ func (f *File) Save(key string, val interface{}) error {
 	return f.save()
 }
 
+func (f *File) LoadRaw(key string) ([]byte, error) {
+	mux := f.mux()
+	mux.RLock()
+	defer mux.RUnlock()
+	f.panicIfClosed()
+	buf, ok := f.vals[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return append([]byte{}, buf...), nil
+}
+
+// SaveRaw saves buf as key.  As the File is written as a single value,
+// buf must be decodable by the File's Codec, and is left out if it is
+// not.
+func (f *File) SaveRaw(key string, buf []byte) error {
+	mux := f.mux()
+	mux.Lock()
+	defer mux.Unlock()
+	f.panicIfClosed()
+	if f.readOnly {
+		return UnWritable(key)
+	}
+	old, had := f.vals[key]
+	f.vals[key] = append([]byte{}, buf...)
+	err := f.save()
+	if err != nil {
+		if had {
+			f.vals[key] = old
+		} else {
+			delete(f.vals, key)
+		}
+	}
+	return err
+}
+
 func (f *File) Remove(key string) error {
 	mux := f.mux()
 	mux.Lock()
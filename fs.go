@@ -0,0 +1,407 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS implements a read-only Store over an fs.FS, such as an embed.FS,
+// laid out like a Directory.  Path is the directory in FS that holds
+// the top-level Store, and Mixed works as it does for a Directory.
+//
+// Use StoreFS to go the other way and read a Store as an fs.FS.
+type FS struct {
+	storeBase
+	FS    fs.FS
+	Path  string
+	Mixed bool
+}
+
+func (f *FS) Type() string {
+	return "fs"
+}
+
+func (f *FS) filename(n string) string {
+	return path.Join(f.Path, url.QueryEscape(n))
+}
+
+// codecs returns the Codecs the FS reads, indexed by file extension.
+func (f *FS) codecs() map[string]Codec {
+	if !f.Mixed {
+		return map[string]Codec{f.Ext(): f.Codec}
+	}
+	res := codecsByExt()
+	res[f.Ext()] = f.Codec
+	return res
+}
+
+// locate returns the name of the file key is stored in and the Codec
+// for it.
+func (f *FS) locate(key string) (string, Codec, error) {
+	fileName, codec := f.filename(key+f.Ext()), f.Codec
+	if !f.Mixed {
+		return fileName, codec, nil
+	}
+	found := false
+	for ext, c := range f.codecs() {
+		candidate := f.filename(key + ext)
+		if _, err := fs.Stat(f.FS, candidate); err != nil {
+			continue
+		}
+		if found {
+			return "", nil, DuplicateKey(path.Join(f.Path, key))
+		}
+		fileName, codec, found = candidate, c, true
+	}
+	return fileName, codec, nil
+}
+
+func (f *FS) codecOf(key string) Codec {
+	if _, codec, err := f.locate(key); err == nil {
+		return codec
+	}
+	return f.Codec
+}
+
+func (f *FS) Open(codec Codec) error {
+	if f.FS == nil {
+		return fmt.Errorf("Cannot read data without an fs.FS")
+	}
+	if f.Path == "" {
+		f.Path = "."
+	}
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	f.Codec = codec
+	entries, err := fs.ReadDir(f.FS, f.Path)
+	if err != nil {
+		return err
+	}
+	f.opened = true
+	f.readOnly = true
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		child := &FS{FS: f.FS, Path: path.Join(f.Path, entry.Name()), Mixed: f.Mixed}
+		if err := child.Open(f.Codec); err != nil {
+			return err
+		}
+		name, err := url.QueryUnescape(entry.Name())
+		if err != nil {
+			name = entry.Name()
+		}
+		addSub(f, child, name)
+	}
+	md := f.MetaData()
+	if n, ok := md["Name"]; ok {
+		f.name = n
+	}
+	return nil
+}
+
+func (f *FS) MakeSub(name string) (Store, error) {
+	f.panicIfClosed()
+	if res := f.GetSub(name); res != nil {
+		return res, nil
+	}
+	return nil, UnWritable(name)
+}
+
+func (f *FS) Keys() ([]string, error) {
+	f.panicIfClosed()
+	entries, err := fs.ReadDir(f.FS, f.Path)
+	if err != nil {
+		return nil, err
+	}
+	codecs := f.codecs()
+	seen := map[string]struct{}{}
+	res := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		name := entry.Name()
+		ext := path.Ext(name)
+		if _, ok := codecs[ext]; !ok {
+			continue
+		}
+		n, err := url.QueryUnescape(strings.TrimSuffix(name, ext))
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := seen[n]; ok {
+			return nil, DuplicateKey(path.Join(f.Path, n))
+		}
+		seen[n] = struct{}{}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+func (f *FS) LoadRaw(key string) ([]byte, error) {
+	f.panicIfClosed()
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	return fs.ReadFile(f.FS, fileName)
+}
+
+func (f *FS) Load(key string, val interface{}) error {
+	f.panicIfClosed()
+	fileName, codec, err := f.locate(key)
+	if err != nil {
+		return err
+	}
+	buf, err := fs.ReadFile(f.FS, fileName)
+	if err != nil {
+		return err
+	}
+	if err := codec.Decode(buf, val); err != nil {
+		return decodeError(fileName, key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(f.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := f.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (f *FS) LoadStream(key string) (io.ReadCloser, error) {
+	f.panicIfClosed()
+	fileName, _, err := f.locate(key)
+	if err != nil {
+		return nil, err
+	}
+	return f.FS.Open(fileName)
+}
+
+func (f *FS) Save(key string, val interface{}) error {
+	f.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (f *FS) SaveRaw(key string, buf []byte) error {
+	f.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (f *FS) SaveStream(key string, r io.Reader) error {
+	f.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (f *FS) Remove(key string) error {
+	f.panicIfClosed()
+	return UnWritable(key)
+}
+
+func (f *FS) MetaData() map[string]string {
+	if f.parentStore != nil {
+		return f.parentStore.(*FS).MetaData()
+	}
+	res := map[string]string{}
+	entries, err := fs.ReadDir(f.FS, f.Path)
+	if err != nil {
+		return res
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		k, ok := metaKey(entry.Name())
+		if !ok {
+			continue
+		}
+		buf, err := fs.ReadFile(f.FS, path.Join(f.Path, entry.Name()))
+		if err != nil {
+			continue
+		}
+		if val := strings.TrimSpace(string(buf)); val != "" {
+			res[k] = val
+		}
+	}
+	return res
+}
+
+func (f *FS) SetMetaData(vals map[string]string) error {
+	return UnWritable("metadata")
+}
+
+// StoreFS returns an fs.FS that shows s laid out like a Directory:
+// each value is a file named after its query-escaped key with the
+// extension of the Codec it is stored with, each substore is a
+// directory, and the metadata of s is in ._X.meta files at the top.
+// Files hold the encoded values, and implement io.Seeker so that the
+// fs.FS can be served with http.FS.
+func StoreFS(s Store) fs.FS {
+	return storeFS{s}
+}
+
+type storeFS struct {
+	s Store
+}
+
+// storeFileInfo implements both fs.FileInfo and fs.DirEntry.
+type storeFileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i *storeFileInfo) Name() string       { return i.name }
+func (i *storeFileInfo) Size() int64        { return i.size }
+func (i *storeFileInfo) ModTime() time.Time { return time.Time{} }
+func (i *storeFileInfo) IsDir() bool        { return i.dir }
+func (i *storeFileInfo) Sys() interface{}   { return nil }
+
+func (i *storeFileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i *storeFileInfo) Type() fs.FileMode          { return i.Mode().Type() }
+func (i *storeFileInfo) Info() (fs.FileInfo, error) { return i, nil }
+
+type storeFile struct {
+	*bytes.Reader
+	info *storeFileInfo
+}
+
+func (f *storeFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *storeFile) Close() error               { return nil }
+
+type storeDir struct {
+	info    *storeFileInfo
+	entries []fs.DirEntry
+}
+
+func (d *storeDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *storeDir) Close() error               { return nil }
+
+func (d *storeDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+func (d *storeDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if n <= 0 || n > len(d.entries) {
+		if n > 0 && len(d.entries) == 0 {
+			return nil, io.EOF
+		}
+		n = len(d.entries)
+	}
+	res := d.entries[:n]
+	d.entries = d.entries[n:]
+	return res, nil
+}
+
+// files returns the contents of the files directly in the directory
+// for s, indexed by name.
+func (sf storeFS) files(s Store, top bool) (map[string][]byte, error) {
+	res := map[string][]byte{}
+	if ms, ok := s.(MetaSaver); ok && top {
+		for k, v := range ms.MetaData() {
+			res[metaFile(k)] = []byte(v)
+		}
+	}
+	keys, err := s.Keys()
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range keys {
+		buf, codec, err := encodedValue(s, key)
+		if err != nil {
+			return nil, err
+		}
+		res[url.QueryEscape(key)+codec.Ext()] = buf
+	}
+	return res, nil
+}
+
+// file returns the contents of the file called name directly in the
+// directory for s, loading only the value it holds.  As keys can hold
+// dots, each place name could be split into a key and an extension is
+// tried.
+func (sf storeFS) file(s Store, top bool, name string) ([]byte, bool) {
+	if k, ok := metaKey(name); ok && top {
+		if ms, ok := s.(MetaSaver); ok {
+			if v, ok := ms.MetaData()[k]; ok {
+				return []byte(v), true
+			}
+		}
+	}
+	for i := 1; i < len(name); i++ {
+		if name[i] != '.' {
+			continue
+		}
+		key, err := url.QueryUnescape(name[:i])
+		if err != nil || url.QueryEscape(key) != name[:i] || keyCodec(s, key).Ext() != name[i:] {
+			continue
+		}
+		if buf, _, err := encodedValue(s, key); err == nil {
+			return buf, true
+		}
+	}
+	return nil, false
+}
+
+func (sf storeFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	notExist := &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	s, parts := sf.s, []string{}
+	if name != "." {
+		parts = strings.Split(name, "/")
+	}
+	for i, part := range parts {
+		sub, err := url.QueryUnescape(part)
+		if err != nil {
+			return nil, notExist
+		}
+		if next := s.GetSub(sub); next != nil {
+			s = next
+			continue
+		}
+		if i != len(parts)-1 {
+			return nil, notExist
+		}
+		buf, ok := sf.file(s, i == 0, part)
+		if !ok {
+			return nil, notExist
+		}
+		return &storeFile{
+			Reader: bytes.NewReader(buf),
+			info:   &storeFileInfo{name: part, size: int64(len(buf))},
+		}, nil
+	}
+	files, err := sf.files(s, len(parts) == 0)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	dir := &storeDir{info: &storeFileInfo{name: path.Base(name), dir: true}}
+	for n, buf := range files {
+		dir.entries = append(dir.entries, &storeFileInfo{name: n, size: int64(len(buf))})
+	}
+	for n := range s.Subs() {
+		dir.entries = append(dir.entries, &storeFileInfo{name: url.QueryEscape(n), dir: true})
+	}
+	sort.Slice(dir.entries, func(i, j int) bool { return dir.entries[i].Name() < dir.entries[j].Name() })
+	return dir, nil
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFS(t *testing.T) {
+	files := fstest.MapFS{
+		"data/" + url.QueryEscape("._Name.meta"):   {Data: []byte("embedded\n")},
+		"data/" + url.QueryEscape("a/b") + ".json": {Data: []byte(`{"Name":"a/b","Val":"top"}`)},
+		"data/sub/c.json":                          {Data: []byte(`{"Name":"c","Val":"sub"}`)},
+		"data/sub/d.yaml":                          {Data: []byte("Name: d\nVal: yaml\n")},
+		"data/README":                              {Data: []byte("not a value")},
+	}
+	s := &FS{FS: files, Path: "data"}
+	if err := s.Open(nil); err != nil {
+		t.Fatalf("Failed to open FS store: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "embedded" || !s.ReadOnly() {
+		t.Errorf("Expected read-only store named embedded, got %q", s.Name())
+	}
+	if keys, _ := s.Keys(); len(keys) != 1 || keys[0] != "a/b" {
+		t.Errorf("Expected keys [a/b], got %v", keys)
+	}
+	val := &TestVal{}
+	if err := s.Load("a/b", val); err != nil || val.Val != "top" {
+		t.Errorf("Failed to load a/b: %v, %v", val, err)
+	}
+	sub := s.GetSub("sub")
+	if sub == nil {
+		t.Fatalf("Expected sub to be a substore")
+	}
+	if keys, _ := sub.Keys(); len(keys) != 1 {
+		t.Errorf("Expected only c in sub, got %v", keys)
+	}
+	if err := s.Load("missing", val); err == nil {
+		t.Errorf("Expected loading a missing key to fail")
+	}
+	if err := s.Save("a/b", val); err != UnWritable("a/b") {
+		t.Errorf("Expected saving to fail, got %v", err)
+	}
+	if _, err := s.MakeSub("other"); err != UnWritable("other") {
+		t.Errorf("Expected making a substore to fail, got %v", err)
+	}
+
+	mixed := &FS{FS: files, Path: "data", Mixed: true}
+	if err := mixed.Open(nil); err != nil {
+		t.Fatalf("Failed to open mixed FS store: %v", err)
+	}
+	if err := mixed.GetSub("sub").Load("d", val); err != nil || val.Val != "yaml" {
+		t.Errorf("Failed to load sub/d: %v, %v", val, err)
+	}
+	mixed.Close()
+}
+
+func TestStoreFS(t *testing.T) {
+	mem, _ := Open("memory:///")
+	defer mem.Close()
+	mem.(MetaSaver).SetMetaData(map[string]string{"Name": "mem"})
+	mem.Save("a/b", &TestVal{Name: "a/b", Val: "top"})
+	sub, _ := mem.MakeSub("sub")
+	sub.Save("c", &TestVal{Name: "c", Val: "sub"})
+	mem.MakeSub("empty")
+
+	fsys := StoreFS(mem)
+	if err := fstest.TestFS(fsys, url.QueryEscape("a/b")+".json", "sub/c.json", "._Name.meta", "empty"); err != nil {
+		t.Fatalf("StoreFS is not a valid fs.FS: %v", err)
+	}
+	if _, err := fsys.Open("sub/missing.json"); err == nil {
+		t.Errorf("Expected opening a missing file to fail")
+	}
+
+	s := &FS{FS: fsys}
+	if err := s.Open(nil); err != nil {
+		t.Fatalf("Failed to open FS over StoreFS: %v", err)
+	}
+	defer s.Close()
+	val := &TestVal{}
+	if s.Name() != "mem" {
+		t.Errorf("Expected name mem, got %q", s.Name())
+	}
+	if err := s.GetSub("sub").Load("c", val); err != nil || val.Val != "sub" {
+		t.Errorf("Failed to load sub/c: %v, %v", val, err)
+	}
+
+	srv := httptest.NewServer(http.FileServer(http.FS(fsys)))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL + "/sub/c.json")
+	if err != nil {
+		t.Fatalf("Failed to get sub/c.json: %v", err)
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || len(body) == 0 {
+		t.Errorf("Expected to serve sub/c.json, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestStoreFSOpenLoadsOneValue(t *testing.T) {
+	mem, _ := Open("memory:///")
+	defer mem.Close()
+	for _, k := range []string{"a", "b.c", "d"} {
+		mem.Save(k, &TestVal{Name: k})
+	}
+	loads := 0
+	counted := Wrap(mem, func(c *Call, next Handler) error {
+		if c.Op == OpLoad {
+			loads++
+		}
+		return next(c)
+	})
+	buf, err := fs.ReadFile(StoreFS(counted), "b.c.json")
+	if err != nil || len(buf) == 0 {
+		t.Fatalf("Failed to read b.c.json: %v", err)
+	}
+	if loads != 1 {
+		t.Errorf("Expected opening one file to load one value, loaded %d", loads)
+	}
+}
@@ -0,0 +1,855 @@
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/storage"
+	"github.com/go-git/go-git/v5/utils/merkletrie"
+)
+
+// Git implements a Store that is backed by a git repository, laid out
+// like a Directory so that a checkout of it can be read by one.  Every
+// Save, Remove, and MakeSub is committed to Branch straight away, and
+// Transaction batches several of them into a single commit.
+// TransactionAs does the same with a message and author of the
+// caller's choosing, even for a single change.  Commits
+// are written to the repository's object database without touching
+// any worktree, so Path is usually a bare repository, which Open
+// creates if it does not exist.  Committing to the branch checked out
+// in a non-bare repository would leave its worktree out of sync, so
+// that is refused.
+//
+// If Ref is set, the Git shows the repository as of Ref, which can be
+// anything git rev-parse understands, and is read-only.  The
+// repository must already exist.
+type Git struct {
+	storeBase
+	Path   string
+	Branch string
+	Ref    string
+	// Author and Email are recorded as the author of every commit not
+	// made with TransactionAs.
+	Author string
+	Email  string
+	// dir is where the values of this Git are in the tree.
+	dir  string
+	repo *git.Repository
+	// mux serializes commits to Branch made through this Git and its
+	// substores.
+	mux *sync.Mutex
+	tx  *gitTx
+}
+
+// gitTx holds the changes made in a Transaction, which are paths in
+// the tree mapped to the hash of their new contents, or to nil if they
+// were removed.
+type gitTx struct {
+	changes map[string]*plumbing.Hash
+	// name is the Name set with SetMetaData, if any.
+	name *string
+}
+
+// GitCommit describes a commit made to a Git.
+type GitCommit struct {
+	Hash    string
+	Author  string
+	Email   string
+	When    time.Time
+	Message string
+}
+
+const gitKeep = ".gitkeep"
+
+// gitFromURI makes a Git Store for a git: locator.
+func gitFromURI(uri *url.URL, path string) *Git {
+	params := uri.Query()
+	return &Git{
+		Path:   path,
+		Branch: params.Get("branch"),
+		Ref:    params.Get("ref"),
+		Author: params.Get("author"),
+		Email:  params.Get("email"),
+	}
+}
+
+func (g *Git) Type() string {
+	return "git"
+}
+
+func (g *Git) branchRef() plumbing.ReferenceName {
+	return plumbing.NewBranchReferenceName(g.Branch)
+}
+
+// treeDir returns the directory in the tree the values of g are in, as
+// path.Dir would return it for their paths.
+func (g *Git) treeDir() string {
+	if g.dir == "" {
+		return "."
+	}
+	return g.dir
+}
+
+// pathOf returns the path in the tree of the file named name.
+func (g *Git) pathOf(name string) string {
+	return path.Join(g.dir, url.QueryEscape(name))
+}
+
+func (g *Git) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	g.Codec = codec
+	if g.Branch == "" {
+		g.Branch = "master"
+	}
+	if g.Author == "" {
+		g.Author = "store"
+	}
+	if g.Email == "" {
+		g.Email = "store@localhost"
+	}
+	if g.mux == nil {
+		g.mux = &sync.Mutex{}
+	}
+	if g.repo == nil {
+		if g.Path == "" {
+			return fmt.Errorf("Cannot store data in ''")
+		}
+		repo, err := git.PlainOpen(g.Path)
+		if err == git.ErrRepositoryNotExists && g.Ref != "" {
+			return fmt.Errorf("No git repository at %s to show %s of", g.Path, g.Ref)
+		}
+		if err == git.ErrRepositoryNotExists {
+			if repo, err = git.PlainInit(g.Path, true); err == nil {
+				err = repo.Storer.SetReference(plumbing.NewSymbolicReference(plumbing.HEAD, g.branchRef()))
+			}
+		}
+		if err != nil {
+			return err
+		}
+		g.repo = repo
+		g.closer = func() {
+			g.repo = nil
+		}
+	}
+	tree, err := g.tree()
+	if err != nil {
+		return err
+	}
+	g.opened = true
+	if g.Ref != "" {
+		g.readOnly = true
+	}
+	subs := []string{}
+	if t, err := g.subtree(tree); err == nil {
+		for _, e := range t.Entries {
+			if e.Mode == filemode.Dir {
+				if name, err := url.QueryUnescape(e.Name); err == nil {
+					subs = append(subs, name)
+				}
+			}
+		}
+	}
+	for _, sub := range subs {
+		if _, err := g.openSub(sub); err != nil {
+			return err
+		}
+	}
+	md := g.MetaData()
+	if n, ok := md["Name"]; ok {
+		g.name = n
+	}
+	return nil
+}
+
+// commitAt returns the commit Ref or Branch refers to, or nil if
+// Branch has no commits yet.
+func (g *Git) commitAt() (*object.Commit, error) {
+	if g.Ref != "" {
+		hash, err := g.repo.ResolveRevision(plumbing.Revision(g.Ref))
+		if err != nil {
+			return nil, err
+		}
+		return g.repo.CommitObject(*hash)
+	}
+	ref, err := g.repo.Reference(g.branchRef(), true)
+	if err == plumbing.ErrReferenceNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return g.repo.CommitObject(ref.Hash())
+}
+
+// tree returns the tree of the commit g refers to, or nil if there is
+// none.
+func (g *Git) tree() (*object.Tree, error) {
+	c, err := g.commitAt()
+	if err != nil || c == nil {
+		return nil, err
+	}
+	return c.Tree()
+}
+
+// subtree returns the part of tree that holds the values of g.
+func (g *Git) subtree(tree *object.Tree) (*object.Tree, error) {
+	if tree == nil {
+		return nil, os.ErrNotExist
+	}
+	if g.dir == "" {
+		return tree, nil
+	}
+	res, err := tree.Tree(g.dir)
+	if err == object.ErrDirectoryNotFound {
+		return nil, os.ErrNotExist
+	}
+	return res, err
+}
+
+// read returns the contents of the file at p, taking any changes made
+// in the current Transaction into account.
+func (g *Git) read(p string) ([]byte, error) {
+	hash, ok := plumbing.ZeroHash, false
+	if g.tx != nil {
+		var h *plumbing.Hash
+		if h, ok = g.tx.changes[p]; ok {
+			if h == nil {
+				return nil, os.ErrNotExist
+			}
+			hash = *h
+		}
+	}
+	if !ok {
+		tree, err := g.tree()
+		if err != nil {
+			return nil, err
+		}
+		if tree == nil {
+			return nil, os.ErrNotExist
+		}
+		f, err := tree.File(p)
+		if err == object.ErrFileNotFound || err == object.ErrDirectoryNotFound {
+			return nil, os.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+		hash = f.Hash
+	}
+	blob, err := g.repo.BlobObject(hash)
+	if err != nil {
+		return nil, err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+func (g *Git) writeBlob(buf []byte) (plumbing.Hash, error) {
+	obj := g.repo.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write(buf); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return g.repo.Storer.SetEncodedObject(obj)
+}
+
+// writeTree writes the tree with the hash base with changes applied
+// to it, and returns its hash.  A zero hash means the tree is empty.
+func (g *Git) writeTree(base plumbing.Hash, changes map[string]*plumbing.Hash) (plumbing.Hash, error) {
+	entries := map[string]object.TreeEntry{}
+	if !base.IsZero() {
+		t, err := g.repo.TreeObject(base)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		for _, e := range t.Entries {
+			entries[e.Name] = e
+		}
+	}
+	subs := map[string]map[string]*plumbing.Hash{}
+	for p, h := range changes {
+		if i := strings.Index(p, "/"); i >= 0 {
+			if subs[p[:i]] == nil {
+				subs[p[:i]] = map[string]*plumbing.Hash{}
+			}
+			subs[p[:i]][p[i+1:]] = h
+		} else if h == nil {
+			delete(entries, p)
+		} else {
+			entries[p] = object.TreeEntry{Name: p, Mode: filemode.Regular, Hash: *h}
+		}
+	}
+	for dir, sub := range subs {
+		subBase := plumbing.ZeroHash
+		if e, ok := entries[dir]; ok && e.Mode == filemode.Dir {
+			subBase = e.Hash
+		}
+		h, err := g.writeTree(subBase, sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		if h.IsZero() {
+			delete(entries, dir)
+		} else {
+			entries[dir] = object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: h}
+		}
+	}
+	if len(entries) == 0 {
+		return plumbing.ZeroHash, nil
+	}
+	return g.storeTree(entries)
+}
+
+func (g *Git) storeTree(entries map[string]object.TreeEntry) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	for _, e := range entries {
+		tree.Entries = append(tree.Entries, e)
+	}
+	// git sorts directories as if their names ended in a /.
+	sortName := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool {
+		return sortName(tree.Entries[i]) < sortName(tree.Entries[j])
+	})
+	obj := g.repo.Storer.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return g.repo.Storer.SetEncodedObject(obj)
+}
+
+// commit commits changes to Branch with the Message, Author, and Email
+// of info, where an empty Author or Email means that of g.  If Branch
+// is moved by someone else in the meantime, the changes are applied
+// again on top of the new commit.
+func (g *Git) commit(info GitCommit, changes map[string]*plumbing.Hash) error {
+	if info.Author == "" {
+		info.Author = g.Author
+	}
+	if info.Email == "" {
+		info.Email = g.Email
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	if err := g.checkNotCheckedOut(); err != nil {
+		return err
+	}
+	for {
+		old, err := g.repo.Reference(g.branchRef(), true)
+		if err != nil && err != plumbing.ErrReferenceNotFound {
+			return err
+		}
+		base, parents := plumbing.ZeroHash, []plumbing.Hash{}
+		if old != nil {
+			parent, err := g.repo.CommitObject(old.Hash())
+			if err != nil {
+				return err
+			}
+			base, parents = parent.TreeHash, []plumbing.Hash{parent.Hash}
+		}
+		tree, err := g.writeTree(base, changes)
+		if err != nil {
+			return err
+		}
+		if tree.IsZero() {
+			if tree, err = g.storeTree(nil); err != nil {
+				return err
+			}
+		}
+		sig := object.Signature{Name: info.Author, Email: info.Email, When: time.Now()}
+		c := &object.Commit{
+			Author:       sig,
+			Committer:    sig,
+			Message:      info.Message,
+			TreeHash:     tree,
+			ParentHashes: parents,
+		}
+		obj := g.repo.Storer.NewEncodedObject()
+		if err := c.Encode(obj); err != nil {
+			return err
+		}
+		hash, err := g.repo.Storer.SetEncodedObject(obj)
+		if err != nil {
+			return err
+		}
+		err = g.repo.Storer.CheckAndSetReference(plumbing.NewHashReference(g.branchRef(), hash), old)
+		if err != storage.ErrReferenceHasChanged {
+			return err
+		}
+	}
+}
+
+// checkNotCheckedOut returns an error if Branch is checked out in the
+// worktree of the repository, which commits would not update.
+func (g *Git) checkNotCheckedOut() error {
+	if _, err := g.repo.Worktree(); err == git.ErrIsBareRepository {
+		return nil
+	}
+	head, err := g.repo.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return nil
+	}
+	if head.Type() == plumbing.SymbolicReference && head.Target() == g.branchRef() {
+		return fmt.Errorf("Cannot commit to %s, which is checked out in %s", g.Branch, g.Path)
+	}
+	return nil
+}
+
+// change records the new contents of the file at p, or its removal if
+// buf is nil, committing it with message unless g is in a Transaction.
+func (g *Git) change(p string, buf []byte, message string) error {
+	var hash *plumbing.Hash
+	if buf != nil {
+		h, err := g.writeBlob(buf)
+		if err != nil {
+			return err
+		}
+		hash = &h
+	}
+	if g.tx != nil {
+		g.tx.changes[p] = hash
+		return nil
+	}
+	return g.commit(GitCommit{Message: message}, map[string]*plumbing.Hash{p: hash})
+}
+
+// Transaction runs fn with a copy of g whose changes, along with those
+// of any substores it makes, are committed to Branch as a single
+// commit with message once fn returns nil.  If fn returns an error,
+// nothing is committed.  The copy must not be used once fn returns.
+func (g *Git) Transaction(message string, fn func(*Git) error) error {
+	return g.TransactionAs(GitCommit{Message: message}, fn)
+}
+
+// TransactionAs is Transaction, with the Message, Author, and Email of
+// the commit taken from info.  An empty Author or Email means that of
+// g, and Hash and When are ignored.  Use it to commit even a single
+// Save, Remove, or MakeSub with a message of its own.  If g is already
+// in a Transaction, fn just runs as part of it.
+func (g *Git) TransactionAs(info GitCommit, fn func(*Git) error) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(g.dir)
+	}
+	if g.tx != nil {
+		return fn(g)
+	}
+	txg := g.txTree(&gitTx{changes: map[string]*plumbing.Hash{}})
+	if err := fn(txg); err != nil {
+		return err
+	}
+	if len(txg.tx.changes) == 0 {
+		return nil
+	}
+	if err := g.commit(info, txg.tx.changes); err != nil {
+		return err
+	}
+	if txg.tx.name != nil {
+		top := g
+		for top.parentStore != nil {
+			top = top.parentStore.(*Git)
+		}
+		top.name = *txg.tx.name
+	}
+	return g.adoptSubs(txg)
+}
+
+// adoptSubs opens the substores made in txg, a copy of g made for a
+// Transaction, which exist now that it is committed.
+func (g *Git) adoptSubs(txg *Git) error {
+	g.Lock()
+	defer g.Unlock()
+	for name, sub := range txg.Subs() {
+		if have, ok := g.subStores[name]; ok {
+			if err := have.(*Git).adoptSubs(sub.(*Git)); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := g.openSub(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// txTree returns a copy of g and its substores that record their
+// changes in tx.
+func (g *Git) txTree(tx *gitTx) *Git {
+	res := g.txCopy(tx, g.dir)
+	for name, sub := range g.Subs() {
+		addSub(res, sub.(*Git).txTree(tx), name)
+	}
+	return res
+}
+
+func (g *Git) txCopy(tx *gitTx, dir string) *Git {
+	res := &Git{
+		Path:   g.Path,
+		Branch: g.Branch,
+		Author: g.Author,
+		Email:  g.Email,
+		dir:    dir,
+		repo:   g.repo,
+		mux:    g.mux,
+		tx:     tx,
+	}
+	res.Codec = g.Codec
+	res.name = g.name
+	res.opened = true
+	return res
+}
+
+func (g *Git) MakeSub(name string) (Store, error) {
+	g.Lock()
+	defer g.Unlock()
+	g.panicIfClosed()
+	if res, ok := g.subStores[name]; ok {
+		return res, nil
+	}
+	if name == "" || strings.Contains(name, "/") || strings.HasPrefix(name, "._") {
+		return nil, fmt.Errorf("Invalid substore name %s", name)
+	}
+	if g.tx != nil {
+		res := g.txCopy(g.tx, g.pathOf(name))
+		if err := g.change(path.Join(res.dir, gitKeep), []byte{}, ""); err != nil {
+			return nil, err
+		}
+		addSub(g, res, name)
+		return res, nil
+	}
+	if !g.readOnly {
+		p := path.Join(g.pathOf(name), gitKeep)
+		if _, err := g.read(p); os.IsNotExist(err) {
+			if err := g.change(p, []byte{}, "Make substore "+g.pathOf(name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return g.openSub(name)
+}
+
+func (g *Git) openSub(name string) (Store, error) {
+	res := &Git{
+		Path:   g.Path,
+		Branch: g.Branch,
+		Ref:    g.Ref,
+		Author: g.Author,
+		Email:  g.Email,
+		dir:    g.pathOf(name),
+		repo:   g.repo,
+		mux:    g.mux,
+	}
+	if err := res.Open(g.Codec); err != nil {
+		return nil, err
+	}
+	addSub(g, res, name)
+	return res, nil
+}
+
+func (g *Git) Keys() ([]string, error) {
+	g.panicIfClosed()
+	names := map[string]bool{}
+	tree, err := g.tree()
+	if err != nil {
+		return nil, err
+	}
+	if t, err := g.subtree(tree); err == nil {
+		for _, e := range t.Entries {
+			names[e.Name] = e.Mode != filemode.Dir
+		}
+	}
+	if g.tx != nil {
+		for p, h := range g.tx.changes {
+			if path.Dir(p) == g.treeDir() {
+				names[path.Base(p)] = h != nil
+			}
+		}
+	}
+	res := []string{}
+	for name, isFile := range names {
+		if !isFile || !strings.HasSuffix(name, g.Ext()) || strings.HasPrefix(name, ".") {
+			continue
+		}
+		key, err := url.QueryUnescape(strings.TrimSuffix(name, g.Ext()))
+		if err != nil {
+			continue
+		}
+		res = append(res, key)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+func (g *Git) LoadRaw(key string) ([]byte, error) {
+	g.panicIfClosed()
+	return g.read(g.pathOf(key + g.Ext()))
+}
+
+func (g *Git) Load(key string, val interface{}) error {
+	buf, err := g.LoadRaw(key)
+	if err != nil {
+		return err
+	}
+	if err := g.Decode(buf, val); err != nil {
+		return decodeError(path.Join(g.Path, g.pathOf(key+g.Ext())), key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(g.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := g.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (g *Git) SaveRaw(key string, buf []byte) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	p := g.pathOf(key + g.Ext())
+	return g.change(p, buf, "Save "+p)
+}
+
+func (g *Git) Save(key string, val interface{}) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := g.Encode(val)
+	if err != nil {
+		return err
+	}
+	return g.SaveRaw(key, buf)
+}
+
+// SaveStream reads all of r into memory and saves it as key.
+func (g *Git) SaveStream(key string, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return g.SaveRaw(key, buf)
+}
+
+func (g *Git) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := g.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (g *Git) Remove(key string) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	p := g.pathOf(key + g.Ext())
+	if _, err := g.read(p); err != nil {
+		return err
+	}
+	return g.change(p, nil, "Remove "+p)
+}
+
+// At returns a read-only view of g as of ref, which can be a branch,
+// a tag, a commit hash, or anything else git rev-parse understands.
+func (g *Git) At(ref string) (*Git, error) {
+	g.panicIfClosed()
+	res := &Git{Path: g.Path, Branch: g.Branch, Ref: ref, dir: g.dir, repo: g.repo, mux: g.mux}
+	if err := res.Open(g.Codec); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// History returns the commits that changed key, newest first.
+func (g *Git) History(key string) ([]GitCommit, error) {
+	g.panicIfClosed()
+	res := []GitCommit{}
+	head, err := g.commitAt()
+	if err != nil || head == nil {
+		return res, err
+	}
+	p := g.pathOf(key + g.Ext())
+	iter, err := g.repo.Log(&git.LogOptions{From: head.Hash, FileName: &p})
+	if err != nil {
+		return nil, err
+	}
+	err = iter.ForEach(func(c *object.Commit) error {
+		res = append(res, GitCommit{
+			Hash:    c.Hash.String(),
+			Author:  c.Author.Name,
+			Email:   c.Author.Email,
+			When:    c.Author.When,
+			Message: c.Message,
+		})
+		return nil
+	})
+	return res, err
+}
+
+// Diff returns the keys in g that differ between the refs from and
+// to.  Keys that were added have an Op of OpCreate, keys that were
+// changed OpUpdate, and keys that were removed OpRemove.
+func (g *Git) Diff(from, to string) ([]Event, error) {
+	g.panicIfClosed()
+	trees := make([]*object.Tree, 2)
+	for i, ref := range []string{from, to} {
+		hash, err := g.repo.ResolveRevision(plumbing.Revision(ref))
+		if err != nil {
+			return nil, err
+		}
+		c, err := g.repo.CommitObject(*hash)
+		if err != nil {
+			return nil, err
+		}
+		if trees[i], err = c.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTree(trees[0], trees[1])
+	if err != nil {
+		return nil, err
+	}
+	res := []Event{}
+	for _, change := range changes {
+		name := change.To.Name
+		if name == "" {
+			name = change.From.Name
+		}
+		if path.Dir(name) != g.treeDir() {
+			continue
+		}
+		base := path.Base(name)
+		if !strings.HasSuffix(base, g.Ext()) || strings.HasPrefix(base, ".") {
+			continue
+		}
+		key, err := url.QueryUnescape(strings.TrimSuffix(base, g.Ext()))
+		if err != nil {
+			continue
+		}
+		action, err := change.Action()
+		if err != nil {
+			return nil, err
+		}
+		ev := Event{Key: key, Op: OpUpdate}
+		switch action {
+		case merkletrie.Insert:
+			ev.Op = OpCreate
+		case merkletrie.Delete:
+			ev.Op = OpRemove
+		}
+		res = append(res, ev)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key < res[j].Key })
+	return res, nil
+}
+
+func (g *Git) MetaData() map[string]string {
+	if g.parentStore != nil {
+		return g.parentStore.(*Git).MetaData()
+	}
+	res := map[string]string{}
+	tree, err := g.tree()
+	if err != nil || tree == nil {
+		return res
+	}
+	for _, e := range tree.Entries {
+		k, ok := metaKey(e.Name)
+		if !ok || e.Mode == filemode.Dir {
+			continue
+		}
+		buf, err := g.read(e.Name)
+		if err != nil {
+			continue
+		}
+		if val := strings.TrimSpace(string(buf)); val != "" {
+			res[k] = val
+		}
+	}
+	return res
+}
+
+// SetMetaData commits vals as the metadata of g, using the same files
+// as a Directory does.  In a Transaction, they are committed along
+// with everything else.
+func (g *Git) SetMetaData(vals map[string]string) error {
+	if g.parentStore != nil {
+		return g.parentStore.(*Git).SetMetaData(vals)
+	}
+	if g.Ref != "" {
+		return UnWritable("metadata")
+	}
+	// Metadata is kept at the top of the tree, even when g is the copy
+	// of a substore made for a Transaction.
+	changes := map[string]*plumbing.Hash{}
+	for k := range g.MetaData() {
+		changes["._"+k+".meta"] = nil
+	}
+	if g.tx != nil {
+		for p := range g.tx.changes {
+			if _, ok := metaKey(p); ok && !strings.Contains(p, "/") {
+				changes[p] = nil
+			}
+		}
+	}
+	for k, v := range vals {
+		h, err := g.writeBlob([]byte(v))
+		if err != nil {
+			return err
+		}
+		changes["._"+k+".meta"] = &h
+	}
+	if g.tx != nil {
+		for p, h := range changes {
+			g.tx.changes[p] = h
+		}
+		if n, ok := vals["Name"]; ok {
+			g.tx.name = &n
+			g.name = n
+		}
+		return nil
+	}
+	if err := g.commit(GitCommit{Message: "Set metadata"}, changes); err != nil {
+		return err
+	}
+	if n, ok := vals["Name"]; ok {
+		g.name = n
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+func TestGitStore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-git-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	s, err := Open("git:" + tmpDir + "?branch=main&author=Tester&email=tester@example.com")
+	if err != nil {
+		t.Fatalf("Failed to open git store: %v", err)
+	}
+	defer s.Close()
+	g := s.(*Git)
+	if err := g.Save("a", &TestVal{Name: "a", Val: "1"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	err = g.Transaction("Add b and c", func(tx *Git) error {
+		if err := tx.Save("b", &TestVal{Name: "b"}); err != nil {
+			return err
+		}
+		if err := tx.Save("a", &TestVal{Name: "a", Val: "2"}); err != nil {
+			return err
+		}
+		sub, err := tx.MakeSub("sub")
+		if err != nil {
+			return err
+		}
+		if err := sub.Save("c", &TestVal{Name: "c"}); err != nil {
+			return err
+		}
+		if keys, _ := tx.Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+			t.Errorf("Expected uncommitted keys to be visible in the transaction, got %v", keys)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if err := g.Remove("b"); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if err := g.Remove("b"); !os.IsNotExist(err) {
+		t.Errorf("Expected removing a missing key to fail, got %v", err)
+	}
+
+	hist, err := g.History("a")
+	if err != nil || len(hist) != 2 {
+		t.Fatalf("Expected 2 commits changing a, got %v, %v", hist, err)
+	}
+	if hist[0].Message != "Add b and c" || hist[0].Author != "Tester" || hist[0].Email != "tester@example.com" {
+		t.Errorf("Unexpected newest commit %#v", hist[0])
+	}
+
+	old, err := g.At("main~1")
+	if err != nil {
+		t.Fatalf("Failed to open git store at a ref: %v", err)
+	}
+	val := &TestVal{}
+	if err := old.Load("b", val); err != nil || val.Name != "b" {
+		t.Errorf("Expected b to exist at main~1, got %v, %v", val, err)
+	}
+	if old.GetSub("sub") == nil {
+		t.Errorf("Expected sub to exist at main~1")
+	}
+	if err := old.Save("b", val); err != UnWritable("b") {
+		t.Errorf("Expected saving at a ref to fail, got %v", err)
+	}
+
+	diff, err := g.Diff(hist[1].Hash, "main")
+	if err != nil {
+		t.Fatalf("Failed to diff: %v", err)
+	}
+	if want := []Event{{Key: "a", Op: OpUpdate}}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected diff %v, got %v", want, diff)
+	}
+	diff, _ = g.Diff("main~2", "main~1")
+	if want := []Event{{Key: "a", Op: OpUpdate}, {Key: "b", Op: OpCreate}}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected diff %v, got %v", want, diff)
+	}
+	diff, _ = g.GetSub("sub").(*Git).Diff("main~2", "main")
+	if want := []Event{{Key: "c", Op: OpCreate}}; !reflect.DeepEqual(diff, want) {
+		t.Errorf("Expected substore diff %v, got %v", want, diff)
+	}
+
+	failed := g.Transaction("Never committed", func(tx *Git) error {
+		tx.Save("d", &TestVal{Name: "d"})
+		return os.ErrInvalid
+	})
+	if failed != os.ErrInvalid {
+		t.Errorf("Expected the transaction error, got %v", failed)
+	}
+	if err := g.Load("d", val); !os.IsNotExist(err) {
+		t.Errorf("Expected a failed transaction not to be committed, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(tmpDir, "HEAD")); err != nil {
+		t.Errorf("Expected a bare repository: %v", err)
+	}
+
+	head, _ := g.repo.Head()
+	err = g.Transaction("Nothing new", func(tx *Git) error {
+		if tx.GetSub("sub") == nil {
+			t.Errorf("Expected existing substores in the transaction")
+		}
+		_, err := tx.MakeSub("sub")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if newHead, _ := g.repo.Head(); newHead.Hash() != head.Hash() {
+		t.Errorf("Expected making an existing substore not to commit anything")
+	}
+	err = g.Transaction("Make nested", func(tx *Git) error {
+		_, err := tx.GetSub("sub").MakeSub("nested")
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if g.GetSub("sub").GetSub("nested") == nil {
+		t.Errorf("Expected a substore made in an existing substore to be opened")
+	}
+
+	info := GitCommit{Message: "Record e", Author: "Someone", Email: "someone@example.com"}
+	if err := g.TransactionAs(info, func(tx *Git) error { return tx.Save("e", &TestVal{Name: "e"}) }); err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	if hist, _ := g.History("e"); len(hist) != 1 || hist[0].Message != "Record e" || hist[0].Author != "Someone" || hist[0].Email != "someone@example.com" {
+		t.Errorf("Expected the commit to use the given message and author, got %#v", hist)
+	}
+
+	head, _ = g.repo.Head()
+	failed = g.Transaction("Metadata never committed", func(tx *Git) error {
+		tx.GetSub("sub").(*Git).SetMetaData(map[string]string{"Name": "lost"})
+		return os.ErrInvalid
+	})
+	if newHead, _ := g.repo.Head(); failed != os.ErrInvalid || newHead.Hash() != head.Hash() || g.Name() == "lost" {
+		t.Errorf("Expected metadata set in a failed transaction not to be committed")
+	}
+	err = g.Transaction("Rename", func(tx *Git) error {
+		if err := tx.SetMetaData(map[string]string{"Name": "renamed"}); err != nil {
+			return err
+		}
+		return tx.Save("f", &TestVal{Name: "f"})
+	})
+	if err != nil {
+		t.Fatalf("Transaction failed: %v", err)
+	}
+	hist, _ = g.History("f")
+	if head, _ := g.repo.Head(); len(hist) != 1 || hist[0].Message != "Rename" || hist[0].Hash != head.Hash().String() {
+		t.Errorf("Expected metadata to be committed with the transaction, got %#v", hist)
+	}
+	if g.Name() != "renamed" || g.MetaData()["Name"] != "renamed" {
+		t.Errorf("Expected the name to be set by the transaction, got %q, %v", g.Name(), g.MetaData())
+	}
+}
+
+func TestGitOpenErrors(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-git-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	missing := filepath.Join(tmpDir, "missing")
+	if _, err := Open("git:" + missing + "?ref=master"); err == nil {
+		t.Errorf("Expected opening a missing repository at a ref to fail")
+	}
+	if _, err := os.Stat(missing); !os.IsNotExist(err) {
+		t.Errorf("Expected no repository to be made: %v", err)
+	}
+
+	work := filepath.Join(tmpDir, "work")
+	if _, err := git.PlainInit(work, false); err != nil {
+		t.Fatalf("Failed to init repository: %v", err)
+	}
+	checkedOut, err := Open("git:" + work)
+	if err != nil {
+		t.Fatalf("Failed to open git store: %v", err)
+	}
+	defer checkedOut.Close()
+	if err := checkedOut.Save("a", &TestVal{Name: "a"}); err == nil || !strings.Contains(err.Error(), "checked out") {
+		t.Errorf("Expected saving to the checked out branch to fail, got %v", err)
+	}
+	other, err := Open("git:" + work + "?branch=data")
+	if err != nil {
+		t.Fatalf("Failed to open git store: %v", err)
+	}
+	defer other.Close()
+	if err := other.Save("a", &TestVal{Name: "a"}); err != nil {
+		t.Errorf("Failed to save to another branch: %v", err)
+	}
+}
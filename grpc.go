@@ -0,0 +1,543 @@
+package store
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/digitalrebar/store/storepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCServer serves Store over the gRPC service defined in
+// storepb/store.proto, which GRPC stores talk to.  Register it with
+// storepb.RegisterStoreServer.  Values are sent as JSON whatever Codec
+// Store uses.  If ReadOnly is set or Store is read-only, requests that
+// would change it fail with codes.PermissionDenied.
+//
+// Watch relays the changes reported by the served Store if it is a
+// Watcher, and otherwise the changes made through the server.
+type GRPCServer struct {
+	storepb.UnimplementedStoreServer
+	Store    Store
+	ReadOnly bool
+	mux      sync.Mutex
+	watches  map[Store]map[*func(Event)]struct{}
+}
+
+func grpcError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch err.(type) {
+	case UnWritable:
+		return status.Error(codes.PermissionDenied, err.Error())
+	case *DecodeError:
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+	if os.IsNotExist(err) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	return err
+}
+
+func (g *GRPCServer) sub(path string) (Store, error) {
+	res := g.Store
+	for _, name := range strings.Split(path, "/") {
+		if name == "" {
+			continue
+		}
+		if res = res.GetSub(name); res == nil {
+			return nil, status.Errorf(codes.NotFound, "No such substore %s", path)
+		}
+	}
+	return res, nil
+}
+
+// writable returns the substore at path if it may be changed.
+func (g *GRPCServer) writable(path string) (Store, error) {
+	if g.ReadOnly || g.Store.ReadOnly() {
+		return nil, status.Error(codes.PermissionDenied, "Store is read-only")
+	}
+	return g.sub(path)
+}
+
+// notify passes ev to the watches on s, unless s can report changes
+// itself.
+func (g *GRPCServer) notify(s Store, ev Event) {
+	if _, ok := asWatcher(s); ok {
+		return
+	}
+	g.mux.Lock()
+	defer g.mux.Unlock()
+	for fn := range g.watches[s] {
+		(*fn)(ev)
+	}
+}
+
+func (g *GRPCServer) Info(ctx context.Context, req *storepb.InfoRequest) (*storepb.InfoResponse, error) {
+	s, err := g.sub(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	return &storepb.InfoResponse{
+		Name:     s.Name(),
+		Type:     s.Type(),
+		ReadOnly: g.ReadOnly || s.ReadOnly(),
+	}, nil
+}
+
+func (g *GRPCServer) Keys(ctx context.Context, req *storepb.KeysRequest) (*storepb.KeysResponse, error) {
+	s, err := g.sub(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := s.Keys()
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.KeysResponse{Keys: keys}, nil
+}
+
+func (g *GRPCServer) Load(ctx context.Context, req *storepb.LoadRequest) (*storepb.LoadResponse, error) {
+	s, err := g.sub(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := loadJSON(s, req.Key)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.LoadResponse{Value: buf}, nil
+}
+
+func (g *GRPCServer) Save(ctx context.Context, req *storepb.SaveRequest) (*storepb.SaveResponse, error) {
+	s, err := g.writable(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	val, err := decodeAny(JsonCodec, req.Value)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.Save(req.Key, val); err != nil {
+		return nil, grpcError(err)
+	}
+	g.notify(s, Event{Key: req.Key, Op: OpSave})
+	return &storepb.SaveResponse{}, nil
+}
+
+func (g *GRPCServer) Remove(ctx context.Context, req *storepb.RemoveRequest) (*storepb.RemoveResponse, error) {
+	s, err := g.writable(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Remove(req.Key); err != nil {
+		return nil, grpcError(err)
+	}
+	g.notify(s, Event{Key: req.Key, Op: OpRemove})
+	return &storepb.RemoveResponse{}, nil
+}
+
+func (g *GRPCServer) Subs(ctx context.Context, req *storepb.SubsRequest) (*storepb.SubsResponse, error) {
+	s, err := g.sub(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	res := &storepb.SubsResponse{Names: []string{}}
+	for name := range s.Subs() {
+		res.Names = append(res.Names, name)
+	}
+	sort.Strings(res.Names)
+	return res, nil
+}
+
+func (g *GRPCServer) MakeSub(ctx context.Context, req *storepb.MakeSubRequest) (*storepb.MakeSubResponse, error) {
+	s, err := g.writable(req.Sub)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.MakeSub(req.Name); err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.MakeSubResponse{}, nil
+}
+
+func (g *GRPCServer) MetaData(ctx context.Context, req *storepb.MetaDataRequest) (*storepb.MetaDataResponse, error) {
+	ms, ok := g.Store.(MetaSaver)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "Store does not have metadata")
+	}
+	return &storepb.MetaDataResponse{Values: ms.MetaData()}, nil
+}
+
+func (g *GRPCServer) SetMetaData(ctx context.Context, req *storepb.SetMetaDataRequest) (*storepb.SetMetaDataResponse, error) {
+	if _, err := g.writable(""); err != nil {
+		return nil, err
+	}
+	ms, ok := g.Store.(MetaSaver)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "Store does not have metadata")
+	}
+	if err := ms.SetMetaData(req.Values); err != nil {
+		return nil, grpcError(err)
+	}
+	return &storepb.SetMetaDataResponse{}, nil
+}
+
+func (g *GRPCServer) Watch(req *storepb.WatchRequest, stream storepb.Store_WatchServer) error {
+	s, err := g.sub(req.Sub)
+	if err != nil {
+		return err
+	}
+	// Events are queued so that a slow client does not hold up the
+	// Store.  If the queue overflows, the client is told that anything
+	// may have changed.  Losing the watch of the Store ends the stream.
+	events := make(chan Event, 64)
+	lost := make(chan struct{})
+	var overflowed int32
+	fn := func(ev Event) {
+		if ev.Op == OpLost {
+			close(lost)
+			return
+		}
+		select {
+		case events <- ev:
+		default:
+			atomic.StoreInt32(&overflowed, 1)
+		}
+	}
+	if w, ok := asWatcher(s); ok {
+		cancel, err := w.Watch(fn)
+		if err != nil {
+			return grpcError(err)
+		}
+		defer cancel()
+	} else {
+		g.mux.Lock()
+		if g.watches == nil {
+			g.watches = map[Store]map[*func(Event)]struct{}{}
+		}
+		if g.watches[s] == nil {
+			g.watches[s] = map[*func(Event)]struct{}{}
+		}
+		g.watches[s][&fn] = struct{}{}
+		g.mux.Unlock()
+		defer func() {
+			g.mux.Lock()
+			delete(g.watches[s], &fn)
+			g.mux.Unlock()
+		}()
+	}
+	// Let the client know the watch is in place.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-lost:
+			return stream.Send(&storepb.WatchEvent{Op: string(OpLost)})
+		case ev := <-events:
+			if atomic.SwapInt32(&overflowed, 0) == 1 {
+				ev = Event{}
+			}
+			if err := stream.Send(&storepb.WatchEvent{Key: ev.Key, Op: string(ev.Op)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// GRPC implements a Store that talks to a GRPCServer.  Like Remote,
+// values are sent to the server as JSON, and substores and metadata
+// behave like those of the served Store.
+type GRPC struct {
+	storeBase
+	// Conn is the connection to the server.  If it is nil, Open dials
+	// Target.
+	Conn   *grpc.ClientConn
+	Target string
+	// TLS makes Open dial Target using TLS.
+	TLS bool
+	// Timeout limits how long each request may take.  It defaults to
+	// 5 seconds.
+	Timeout time.Duration
+	// Sub is the /-separated path to the substore of the served Store
+	// this GRPC refers to.
+	Sub    string
+	client storepb.StoreClient
+}
+
+// grpcFromURI makes a GRPC Store for a grpc: locator.
+func grpcFromURI(uri *url.URL) (*GRPC, error) {
+	res := &GRPC{Target: uri.Host}
+	switch tlsParam := uri.Query().Get("tls"); tlsParam {
+	case "true", "yes", "1":
+		res.TLS = true
+	case "false", "no", "0", "":
+	default:
+		return nil, fmt.Errorf("Unknown tls value %s. Try true or false", tlsParam)
+	}
+	return res, nil
+}
+
+func (g *GRPC) Type() string {
+	return "grpc"
+}
+
+func (g *GRPC) ctx() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), g.Timeout)
+}
+
+// clientError turns the status errors the server returns for key back
+// into the errors a Store returns.
+func clientError(key string, err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return os.ErrNotExist
+	case codes.PermissionDenied:
+		return UnWritable(key)
+	}
+	return err
+}
+
+func (g *GRPC) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	g.Codec = codec
+	if g.Timeout == 0 {
+		g.Timeout = 5 * time.Second
+	}
+	if g.Conn == nil {
+		creds := insecure.NewCredentials()
+		if g.TLS {
+			creds = credentials.NewTLS(&tls.Config{})
+		}
+		conn, err := grpc.Dial(g.Target, grpc.WithTransportCredentials(creds))
+		if err != nil {
+			return err
+		}
+		g.Conn = conn
+		g.closer = func() {
+			g.Conn.Close()
+			g.Conn = nil
+		}
+	}
+	g.client = storepb.NewStoreClient(g.Conn)
+	ctx, cancel := g.ctx()
+	defer cancel()
+	info, err := g.client.Info(ctx, &storepb.InfoRequest{Sub: g.Sub})
+	if err != nil {
+		return err
+	}
+	subs, err := g.client.Subs(ctx, &storepb.SubsRequest{Sub: g.Sub})
+	if err != nil {
+		return err
+	}
+	g.opened = true
+	g.name = info.Name
+	g.readOnly = info.ReadOnly
+	for _, name := range subs.Names {
+		if _, err := g.openSub(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GRPC) subPath(name string) string {
+	if g.Sub == "" {
+		return name
+	}
+	return g.Sub + "/" + name
+}
+
+func (g *GRPC) MakeSub(name string) (Store, error) {
+	g.Lock()
+	defer g.Unlock()
+	g.panicIfClosed()
+	if res, ok := g.subStores[name]; ok {
+		return res, nil
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("Invalid substore name %s", name)
+	}
+	ctx, cancel := g.ctx()
+	defer cancel()
+	if _, err := g.client.MakeSub(ctx, &storepb.MakeSubRequest{Sub: g.Sub, Name: name}); err != nil {
+		return nil, clientError(name, err)
+	}
+	return g.openSub(name)
+}
+
+// openSub opens the substore name, which must already exist on the
+// server.
+func (g *GRPC) openSub(name string) (Store, error) {
+	res := &GRPC{Conn: g.Conn, Timeout: g.Timeout, Sub: g.subPath(name)}
+	if err := res.Open(g.Codec); err != nil {
+		return nil, err
+	}
+	addSub(g, res, name)
+	return res, nil
+}
+
+func (g *GRPC) Keys() ([]string, error) {
+	g.panicIfClosed()
+	ctx, cancel := g.ctx()
+	defer cancel()
+	resp, err := g.client.Keys(ctx, &storepb.KeysRequest{Sub: g.Sub})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Keys == nil {
+		return []string{}, nil
+	}
+	return resp.Keys, nil
+}
+
+// LoadRaw loads key from the server, and converts it from the JSON
+// sent over the wire to what the Codec of g encodes it to.
+func (g *GRPC) LoadRaw(key string) ([]byte, error) {
+	g.panicIfClosed()
+	ctx, cancel := g.ctx()
+	defer cancel()
+	resp, err := g.client.Load(ctx, &storepb.LoadRequest{Sub: g.Sub, Key: key})
+	if err != nil {
+		return nil, clientError(key, err)
+	}
+	return fromJSON(g.Codec, resp.Value)
+}
+
+func (g *GRPC) Load(key string, val interface{}) error {
+	buf, err := g.LoadRaw(key)
+	if err != nil {
+		return err
+	}
+	if err := g.Decode(buf, val); err != nil {
+		return decodeError(g.Target, key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(g.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := g.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (g *GRPC) Save(key string, val interface{}) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := toJSON(g.Codec, val)
+	if err != nil {
+		return err
+	}
+	return g.saveJSON(key, buf)
+}
+
+// SaveRaw converts buf, which must be encoded with the Codec of g, to
+// JSON and saves it on the server.
+func (g *GRPC) SaveRaw(key string, buf []byte) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := rawToJSON(g.Codec, buf)
+	if err != nil {
+		return err
+	}
+	return g.saveJSON(key, buf)
+}
+
+func (g *GRPC) saveJSON(key string, buf []byte) error {
+	ctx, cancel := g.ctx()
+	defer cancel()
+	_, err := g.client.Save(ctx, &storepb.SaveRequest{Sub: g.Sub, Key: key, Value: buf})
+	return clientError(key, err)
+}
+
+func (g *GRPC) Remove(key string) error {
+	g.panicIfClosed()
+	if g.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx, cancel := g.ctx()
+	defer cancel()
+	_, err := g.client.Remove(ctx, &storepb.RemoveRequest{Sub: g.Sub, Key: key})
+	return clientError(key, err)
+}
+
+// Watch calls fn for every change the server reports to g until
+// cancel is called.  If the connection to the server or the watch of
+// the served Store is lost, fn is called with an OpLost Event.
+func (g *GRPC) Watch(fn func(Event)) (func(), error) {
+	g.panicIfClosed()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := g.client.Watch(ctx, &storepb.WatchRequest{Sub: g.Sub})
+	if err == nil {
+		// The server sends its headers once the watch is in place.
+		_, err = stream.Header()
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	go func() {
+		for {
+			ev, err := stream.Recv()
+			if err != nil {
+				if ctx.Err() == nil {
+					fn(Event{Op: OpLost})
+				}
+				return
+			}
+			fn(Event{Key: ev.Key, Op: Op(ev.Op)})
+			if Op(ev.Op) == OpLost {
+				cancel()
+				return
+			}
+		}
+	}()
+	return cancel, nil
+}
+
+func (g *GRPC) MetaData() map[string]string {
+	ctx, cancel := g.ctx()
+	defer cancel()
+	resp, err := g.client.MetaData(ctx, &storepb.MetaDataRequest{})
+	if err != nil || resp.Values == nil {
+		return map[string]string{}
+	}
+	return resp.Values
+}
+
+func (g *GRPC) SetMetaData(vals map[string]string) error {
+	ctx, cancel := g.ctx()
+	defer cancel()
+	if _, err := g.client.SetMetaData(ctx, &storepb.SetMetaDataRequest{Values: vals}); err != nil {
+		return clientError("", err)
+	}
+	if n, ok := vals["Name"]; ok {
+		g.name = n
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package store
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/digitalrebar/store/storepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestGRPCStore(t *testing.T) {
+	backing, _ := Open("memory:///")
+	server := &GRPCServer{Store: backing}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, server)
+	go srv.Serve(lis)
+	defer srv.Stop()
+	dial := func() *grpc.ClientConn {
+		conn, err := grpc.Dial("bufnet",
+			grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+			grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("Failed to dial: %v", err)
+		}
+		return conn
+	}
+
+	conn := dial()
+	defer conn.Close()
+	s := &GRPC{Conn: conn}
+	if err := s.Open(nil); err != nil {
+		t.Fatalf("Failed to open grpc store: %v", err)
+	}
+	testStore(t, s)
+	if err := s.SetMetaData(map[string]string{"Name": "grpc"}); err != nil {
+		t.Errorf("Failed to set metadata: %v", err)
+	}
+
+	s = &GRPC{Conn: conn}
+	if err := s.Open(nil); err != nil {
+		t.Fatalf("Failed to reopen grpc store: %v", err)
+	}
+	if s.Name() != "grpc" || backing.Name() != "grpc" {
+		t.Errorf("Metadata was not saved to the served store")
+	}
+	if s.GetSub("sub1") == nil || s.GetSub("sub1").GetSub("sub2") == nil {
+		t.Errorf("Substores did not persist")
+	}
+	if err := s.Save("big", &bigVal{ID: 1<<62 + 1, Neg: -1<<62 - 1}); err != nil {
+		t.Errorf("Failed to save: %v", err)
+	}
+	big := &bigVal{}
+	if err := s.Load("big", big); err != nil || big.ID != 1<<62+1 || big.Neg != -1<<62-1 {
+		t.Errorf("Value did not round trip exactly: %v, %v", big, err)
+	}
+	testConvertedRaw(t, s)
+
+	events := make(chan Event, 10)
+	cancel, err := s.Watch(func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer cancel()
+	other := &GRPC{Conn: dial()}
+	if err := other.Open(nil); err != nil {
+		t.Fatalf("Failed to open second grpc store: %v", err)
+	}
+	defer other.Close()
+	if err := other.Save("watched", &TestVal{Name: "watched"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if err := other.Remove("watched"); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if err := other.GetSub("sub1").Save("elsewhere", &TestVal{Name: "elsewhere"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	for _, want := range []Event{{Key: "watched", Op: OpSave}, {Key: "watched", Op: OpRemove}} {
+		select {
+		case ev := <-events:
+			if ev != want {
+				t.Errorf("Expected watch event %#v, got %#v", want, ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for watch event %#v", want)
+		}
+	}
+	select {
+	case ev := <-events:
+		t.Errorf("Unexpected watch event %#v for a substore", ev)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	server.ReadOnly = true
+	if err := s.Save("big", &bigVal{}); err != UnWritable("big") {
+		t.Errorf("Expected the server to refuse writes, got %v", err)
+	}
+	ro := &GRPC{Conn: conn}
+	if err := ro.Open(nil); err != nil {
+		t.Fatalf("Failed to open read-only grpc store: %v", err)
+	}
+	if !ro.ReadOnly() {
+		t.Errorf("Expected grpc store to be read-only")
+	}
+}
+
+func TestGRPCWatchLost(t *testing.T) {
+	backing := &watchedMemory{Memory: &Memory{}}
+	backing.Open(nil)
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	storepb.RegisterStoreServer(srv, &GRPCServer{Store: backing})
+	go srv.Serve(lis)
+	defer srv.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+	s := &GRPC{Conn: conn}
+	if err := s.Open(nil); err != nil {
+		t.Fatalf("Failed to open grpc store: %v", err)
+	}
+	expectLost := func(events chan Event) {
+		select {
+		case ev := <-events:
+			if ev.Op != OpLost {
+				t.Errorf("Expected a lost watch event, got %#v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for the watch to be lost")
+		}
+	}
+
+	// The watch of the served Store is lost.
+	events := make(chan Event, 10)
+	cancel, err := s.Watch(func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer cancel()
+	backing.lose()
+	expectLost(events)
+
+	// The connection to the server is lost.
+	events = make(chan Event, 10)
+	cancel, err = s.Watch(func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer cancel()
+	srv.Stop()
+	expectLost(events)
+}
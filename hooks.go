@@ -0,0 +1,195 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Op identifies the KeySaver operation that is running hooks.
+type Op string
+
+const (
+	OpLoad   Op = "load"
+	OpList   Op = "list"
+	OpCreate Op = "create"
+	OpUpdate Op = "update"
+	OpSave   Op = "save"
+	OpRemove Op = "remove"
+	OpPatch  Op = "patch"
+)
+
+// HookContext is passed to the context-aware hooks.  It records the
+// Store (or substore) the operation is running against, which
+// operation is running, the copy of the object that is currently in
+// the Store for Update() and Patch(), and any values the caller
+// passed to one of the *With functions.  Context is the context given
+// to WithContext to make Store, or context.Background().
+type HookContext struct {
+	Store    Store
+	Op       Op
+	Previous KeySaver
+	Values   map[string]interface{}
+	Context  context.Context
+	// etag is set when Store is an ETagStore and the object must only
+	// be saved if it still has this ETag.
+	etag *string
+}
+
+func newHookContext(s Store, op Op, vals map[string]interface{}) *HookContext {
+	if vals == nil {
+		vals = map[string]interface{}{}
+	}
+	return &HookContext{Store: s, Op: op, Values: vals, Context: contextOf(s)}
+}
+
+// Value returns the caller-supplied value for name, or nil if
+// there is none.
+func (c *HookContext) Value(name string) interface{} {
+	return c.Values[name]
+}
+
+// LoadContextHooker is the context-aware version of LoadHooker.
+// OnLoadContext() is called after OnLoad().
+type LoadContextHooker interface {
+	KeySaver
+	OnLoadContext(*HookContext) error
+}
+
+// ChangeContextHooker is the context-aware version of ChangeHooker.
+// The copy of the object currently in the Backend() is available as
+// HookContext.Previous.  OnChangeContext() is called after OnChange().
+type ChangeContextHooker interface {
+	KeySaver
+	OnChangeContext(*HookContext) error
+}
+
+// CreateContextHooker is the context-aware version of CreateHooker.
+// OnCreateContext() is called after OnCreate().
+type CreateContextHooker interface {
+	KeySaver
+	OnCreateContext(*HookContext) error
+}
+
+// BeforeSaveContextHooker is the context-aware version of
+// BeforeSaveHooker.  BeforeSaveContext() is called after BeforeSave().
+type BeforeSaveContextHooker interface {
+	KeySaver
+	BeforeSaveContext(*HookContext) error
+}
+
+// ValidateHooker is the interface things can satisfy if they want to
+// check themselves before they are saved.  Validate() is called after
+// the BeforeSave hooks, and if it returns a non-nil error the object
+// will not be saved.  Validate() should collect every problem it finds
+// in a ValidationError rather than stopping at the first one.
+type ValidateHooker interface {
+	KeySaver
+	Validate(*HookContext) error
+}
+
+// AfterSaveContextHooker is the context-aware version of
+// AfterSaveHooker.  AfterSaveContext() is called after AfterSave().
+// Since the object has already been saved, an error it returns is
+// reported to the caller along with a true result.
+type AfterSaveContextHooker interface {
+	KeySaver
+	AfterSaveContext(*HookContext) error
+}
+
+// AfterCreateHooker is the interface things can satisfy if they want
+// to perform an action after Create() has saved a new object.
+// AfterCreate() is called after the AfterSave hooks.
+type AfterCreateHooker interface {
+	KeySaver
+	AfterCreate(*HookContext) error
+}
+
+// AfterUpdateHooker is the interface things can satisfy if they want
+// to perform an action after Update() or Patch() has saved an object.
+// AfterUpdate() is called after the AfterSave hooks.
+type AfterUpdateHooker interface {
+	KeySaver
+	AfterUpdate(*HookContext) error
+}
+
+// BeforeDeleteContextHooker is the context-aware version of
+// BeforeDeleteHooker.  BeforeDeleteContext() is called after
+// BeforeDelete().
+type BeforeDeleteContextHooker interface {
+	KeySaver
+	BeforeDeleteContext(*HookContext) error
+}
+
+// AfterDeleteContextHooker is the context-aware version of
+// AfterDeleteHooker.  AfterDeleteContext() is called after
+// AfterDelete(), and an error it returns is reported to the caller
+// along with a true result.
+type AfterDeleteContextHooker interface {
+	KeySaver
+	AfterDeleteContext(*HookContext) error
+}
+
+// FieldError is a single problem found by Validate().
+type FieldError struct {
+	Field   string
+	Message string
+}
+
+func (f FieldError) String() string {
+	return fmt.Sprintf("%s: %s", f.Field, f.Message)
+}
+
+// ValidationError aggregates all of the FieldErrors found while
+// validating an object.
+type ValidationError struct {
+	Prefix string
+	Key    string
+	Errors []FieldError
+}
+
+// Add records a problem with field.
+func (v *ValidationError) Add(field, format string, args ...interface{}) {
+	v.Errors = append(v.Errors, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// HasErrors returns whether any problems have been recorded.
+func (v *ValidationError) HasErrors() bool {
+	return v != nil && len(v.Errors) > 0
+}
+
+// OrNil returns v if it has recorded any problems, and nil otherwise.
+func (v *ValidationError) OrNil() error {
+	if v.HasErrors() {
+		return v
+	}
+	return nil
+}
+
+func (v *ValidationError) Error() string {
+	msgs := make([]string, len(v.Errors))
+	for i := range v.Errors {
+		msgs[i] = v.Errors[i].String()
+	}
+	return fmt.Sprintf("%s:%s is not valid:\n\t%s", v.Prefix, v.Key, strings.Join(msgs, "\n\t"))
+}
+
+func validate(ctx *HookContext, k KeySaver) error {
+	h, ok := k.(ValidateHooker)
+	if !ok {
+		return nil
+	}
+	err := h.Validate(ctx)
+	if ve, ok := err.(*ValidationError); ok {
+		if !ve.HasErrors() {
+			return nil
+		}
+		if ve.Prefix == "" {
+			ve.Prefix = k.Prefix()
+		}
+		if ve.Key == "" {
+			ve.Key = k.Key()
+		}
+	}
+	return err
+}
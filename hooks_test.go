@@ -0,0 +1,94 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+type ctxVal struct {
+	Name  string
+	Count int
+	seen  []string
+}
+
+func (c *ctxVal) Prefix() string  { return "ctxVal" }
+func (c *ctxVal) Key() string     { return c.Name }
+func (c *ctxVal) KeyName() string { return "Name" }
+func (c *ctxVal) New() KeySaver   { return &ctxVal{} }
+
+func (c *ctxVal) record(ctx *HookContext, hook string) {
+	c.seen = append(c.seen, fmt.Sprintf("%s:%s:%v", hook, ctx.Op, ctx.Value("who")))
+}
+
+func (c *ctxVal) OnChangeContext(ctx *HookContext) error {
+	c.record(ctx, "OnChange")
+	if ctx.Previous.(*ctxVal).Count > c.Count {
+		return errors.New("Count cannot go backwards")
+	}
+	return nil
+}
+
+func (c *ctxVal) Validate(ctx *HookContext) error {
+	res := &ValidationError{}
+	if c.Count < 0 {
+		res.Add("Count", "must not be negative")
+	}
+	if c.Count > 10 {
+		res.Add("Count", "must not be more than 10")
+	}
+	return res.OrNil()
+}
+
+func (c *ctxVal) AfterCreate(ctx *HookContext) error {
+	c.record(ctx, "AfterCreate")
+	return nil
+}
+
+func (c *ctxVal) AfterUpdate(ctx *HookContext) error {
+	c.record(ctx, "AfterUpdate")
+	return nil
+}
+
+func (c *ctxVal) AfterDeleteContext(ctx *HookContext) error {
+	c.record(ctx, "AfterDelete")
+	return errors.New("After delete failed")
+}
+
+func TestContextHooks(t *testing.T) {
+	s, _ := Open("memory:///")
+	vals := map[string]interface{}{"who": "tester"}
+	obj := &ctxVal{Name: "ctx", Count: -1}
+	if ok, err := CreateWith(s, obj, vals); ok {
+		t.Errorf("Expected create of invalid object to fail")
+	} else if ve, isVE := err.(*ValidationError); !isVE {
+		t.Errorf("Expected ValidationError, got %v", err)
+	} else if ve.Key != "ctx" || ve.Prefix != "ctxVal" || len(ve.Errors) != 1 {
+		t.Errorf("Unexpected ValidationError contents: %#v", ve)
+	}
+	obj.Count = 1
+	if ok, err := CreateWith(s, obj, vals); !ok || err != nil {
+		t.Errorf("Expected create to succeed, got %v", err)
+	}
+	obj.Count = 0
+	if ok, _ := UpdateWith(s, obj, vals); ok {
+		t.Errorf("Expected OnChangeContext to veto the update")
+	}
+	obj.Count = 2
+	if ok, err := UpdateWith(s, obj, vals); !ok || err != nil {
+		t.Errorf("Expected update to succeed, got %v", err)
+	}
+	if ok, err := RemoveWith(s, obj, vals); !ok || err == nil {
+		t.Errorf("Expected remove to succeed with an AfterDelete error, got %v, %v", ok, err)
+	}
+	expected := []string{
+		"AfterCreate:create:tester",
+		"OnChange:update:tester",
+		"OnChange:update:tester",
+		"AfterUpdate:update:tester",
+		"AfterDelete:remove:tester",
+	}
+	if fmt.Sprint(expected) != fmt.Sprint(obj.seen) {
+		t.Errorf("Expected hooks %v, got %v", expected, obj.seen)
+	}
+}
@@ -0,0 +1,585 @@
+package store
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HTTPServer is an http.Handler that serves Store over a REST API,
+// which Remote stores talk to.  Values are sent as JSON whatever Codec
+// Store uses.  The API is:
+//
+//	GET    /                 the Name, Type, ReadOnly flag, and substores
+//	GET    /keys             the keys, as a JSON array
+//	POST   /subs/name        makes the substore name
+//	GET    /values/key       loads key, with an ETag
+//	PUT    /values/key       saves key, honoring If-Match and If-None-Match
+//	DELETE /values/key       removes key, honoring If-Match
+//	GET    /meta             the metadata, as a JSON object
+//	PUT    /meta             sets the metadata
+//
+// Every request but those for /meta takes an optional sub query
+// parameter, which is the /-separated path to the substore to use.  If
+// Token is set, requests must carry it as a bearer token.  If ReadOnly
+// is set or Store is read-only, requests that would change it fail
+// with 403 Forbidden.
+type HTTPServer struct {
+	Store    Store
+	Token    string
+	ReadOnly bool
+	// MaxBody is the largest request body, in bytes, that is accepted.
+	// Larger ones fail with 413 Request Entity Too Large.  It defaults
+	// to DefaultMaxBody.
+	MaxBody int64
+	// mux serializes writes made through the server, so that checking
+	// an ETag and saving a value cannot be interleaved with another
+	// request.  Writes made to Store directly are not serialized, and
+	// can still happen in between.
+	mux sync.Mutex
+}
+
+// DefaultMaxBody is the MaxBody of an HTTPServer that does not set one.
+const DefaultMaxBody = 32 << 20
+
+type remoteInfo struct {
+	Name     string
+	Type     string
+	ReadOnly bool
+	Subs     []string
+}
+
+// valueETag returns the ETag of the bytes a value is encoded as.
+func valueETag(buf []byte) string {
+	sum := sha256.Sum256(buf)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err.(type) {
+	case UnWritable:
+		code = http.StatusForbidden
+	case *DecodeError:
+		code = http.StatusBadRequest
+	default:
+		if os.IsNotExist(err) {
+			code = http.StatusNotFound
+		}
+	}
+	http.Error(w, err.Error(), code)
+}
+
+func writeJSON(w http.ResponseWriter, val interface{}) {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
+// sub finds the substore named by the sub parameter of r.
+func (h *HTTPServer) sub(r *http.Request) Store {
+	res := h.Store
+	for _, name := range strings.Split(r.URL.Query().Get("sub"), "/") {
+		if name == "" {
+			continue
+		}
+		if res = res.GetSub(name); res == nil {
+			return nil
+		}
+	}
+	return res
+}
+
+func (h *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.Token != "" {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "Bearer ") ||
+			subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(h.Token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+	}
+	readOnly := h.ReadOnly || h.Store.ReadOnly()
+	if readOnly && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Store is read-only", http.StatusForbidden)
+		return
+	}
+	if r.URL.Path == "/meta" {
+		h.serveMeta(w, r)
+		return
+	}
+	s := h.sub(r)
+	if s == nil {
+		http.Error(w, "No such substore", http.StatusNotFound)
+		return
+	}
+	path := r.URL.EscapedPath()
+	switch {
+	case path == "/" && r.Method == http.MethodGet:
+		info := &remoteInfo{Name: s.Name(), Type: s.Type(), ReadOnly: readOnly, Subs: []string{}}
+		for name := range s.Subs() {
+			info.Subs = append(info.Subs, name)
+		}
+		sort.Strings(info.Subs)
+		writeJSON(w, info)
+	case path == "/keys" && r.Method == http.MethodGet:
+		keys, err := s.Keys()
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		writeJSON(w, keys)
+	case strings.HasPrefix(path, "/subs/") && r.Method == http.MethodPost:
+		name, err := url.PathUnescape(strings.TrimPrefix(path, "/subs/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if _, err := s.MakeSub(name); err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case strings.HasPrefix(path, "/values/"):
+		key, err := url.PathUnescape(strings.TrimPrefix(path, "/values/"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.serveValue(w, r, s, key)
+	default:
+		http.Error(w, "Not found", http.StatusNotFound)
+	}
+}
+
+// readBody reads the body of r, up to MaxBody bytes.  If it fails, an
+// error has been sent to w.
+func (h *HTTPServer) readBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	max := h.MaxBody
+	if max <= 0 {
+		max = DefaultMaxBody
+	}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, max))
+	if err != nil {
+		code := http.StatusBadRequest
+		if _, ok := err.(*http.MaxBytesError); ok {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, err.Error(), code)
+		return nil, false
+	}
+	return body, true
+}
+
+func (h *HTTPServer) serveMeta(w http.ResponseWriter, r *http.Request) {
+	ms, ok := h.Store.(MetaSaver)
+	if !ok {
+		http.Error(w, "Store does not have metadata", http.StatusNotImplemented)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, ms.MetaData())
+	case http.MethodPut:
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+		vals := map[string]string{}
+		if err := json.Unmarshal(body, &vals); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := ms.SetMetaData(vals); err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// precondition checks the If-Match and If-None-Match headers of r
+// against key in s, returning false if they do not hold.
+func (h *HTTPServer) precondition(r *http.Request, s Store, key string) (bool, error) {
+	ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+	if ifMatch == "" && ifNoneMatch == "" {
+		return true, nil
+	}
+	buf, err := loadJSON(s, key)
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	exists := err == nil
+	if ifMatch != "" && (!exists || (ifMatch != "*" && ifMatch != valueETag(buf))) {
+		return false, nil
+	}
+	if ifNoneMatch == "*" && exists {
+		return false, nil
+	}
+	return true, nil
+}
+
+func (h *HTTPServer) serveValue(w http.ResponseWriter, r *http.Request, s Store, key string) {
+	if r.Method != http.MethodGet {
+		h.mux.Lock()
+		defer h.mux.Unlock()
+		if ok, err := h.precondition(r, s, key); err != nil {
+			httpError(w, err)
+			return
+		} else if !ok {
+			http.Error(w, "Precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+	}
+	switch r.Method {
+	case http.MethodGet:
+		buf, err := loadJSON(s, key)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		etag := valueETag(buf)
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(buf)
+	case http.MethodPut:
+		body, ok := h.readBody(w, r)
+		if !ok {
+			return
+		}
+		val, err := decodeAny(JsonCodec, body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := s.Save(key, val); err != nil {
+			httpError(w, err)
+			return
+		}
+		if buf, err := loadJSON(s, key); err == nil {
+			w.Header().Set("ETag", valueETag(buf))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := s.Remove(key); err != nil {
+			httpError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Remote implements a Store that talks to an HTTPServer.  Values are
+// sent to the server as JSON, and are encoded with the Codec of the
+// served Store once they get there, so the Codec of a Remote only
+// matters for how values are decoded.  Substores and metadata behave
+// like those of the served Store.  LoadRaw and SaveRaw convert values
+// between the JSON sent over the wire and what the Codec of the Remote
+// encodes them to.
+type Remote struct {
+	storeBase
+	// URL is where the HTTPServer is mounted.
+	URL   string
+	Token string
+	// Client is used to talk to the server.  It defaults to
+	// http.DefaultClient.
+	Client *http.Client
+	// Sub is the /-separated path to the substore of the served Store
+	// this Remote refers to.
+	Sub string
+}
+
+// remoteFromURI makes a Remote Store for an http: or https: locator.
+// Parameters meant for Open are stripped from the URL.
+func remoteFromURI(uri *url.URL) *Remote {
+	params := uri.Query()
+	res := &Remote{Token: params.Get("token")}
+	for _, p := range []string{"codec", "ro", "strict", "keyfile", "token"} {
+		params.Del(p)
+	}
+	u := *uri
+	u.RawQuery = params.Encode()
+	res.URL = u.String()
+	return res
+}
+
+func (r *Remote) Type() string {
+	return "http"
+}
+
+// do sends a request to the server for the path p, which must already
+// be escaped, and returns the response if the request succeeded.  key
+// is used to build the errors for failed requests.
+func (r *Remote) do(method, p, key string, body []byte, hdrs map[string]string) ([]byte, http.Header, error) {
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	u, err = u.Parse(strings.TrimSuffix(u.EscapedPath(), "/") + p)
+	if err != nil {
+		return nil, nil, err
+	}
+	if r.Sub != "" {
+		u.RawQuery = url.Values{"sub": {r.Sub}}.Encode()
+	}
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, u.String(), rd)
+	if err != nil {
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if r.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.Token)
+	}
+	for k, v := range hdrs {
+		req.Header.Set(k, v)
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	buf, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		return buf, resp.Header, nil
+	case http.StatusNotFound:
+		return nil, nil, os.ErrNotExist
+	case http.StatusForbidden:
+		return nil, nil, UnWritable(key)
+	case http.StatusPreconditionFailed:
+		return nil, nil, StaleRevision(key)
+	default:
+		return nil, nil, fmt.Errorf("%s %s: %s: %s", method, u.Path, resp.Status, strings.TrimSpace(string(buf)))
+	}
+}
+
+func (r *Remote) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	r.Codec = codec
+	if r.Client == nil {
+		r.Client = http.DefaultClient
+	}
+	buf, _, err := r.do(http.MethodGet, "/", "", nil, nil)
+	if err != nil {
+		return err
+	}
+	info := &remoteInfo{}
+	if err := json.Unmarshal(buf, info); err != nil {
+		return fmt.Errorf("Invalid response from %s: %v", r.URL, err)
+	}
+	r.opened = true
+	r.name = info.Name
+	r.readOnly = info.ReadOnly
+	for _, name := range info.Subs {
+		if _, err := r.openSub(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Remote) subPath(name string) string {
+	if r.Sub == "" {
+		return name
+	}
+	return r.Sub + "/" + name
+}
+
+func (r *Remote) MakeSub(name string) (Store, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.panicIfClosed()
+	if res, ok := r.subStores[name]; ok {
+		return res, nil
+	}
+	if name == "" || strings.Contains(name, "/") {
+		return nil, fmt.Errorf("Invalid substore name %s", name)
+	}
+	if _, _, err := r.do(http.MethodPost, "/subs/"+url.PathEscape(name), name, nil, nil); err != nil {
+		return nil, err
+	}
+	return r.openSub(name)
+}
+
+// openSub opens the substore name, which must already exist on the
+// server.
+func (r *Remote) openSub(name string) (Store, error) {
+	res := &Remote{URL: r.URL, Token: r.Token, Client: r.Client, Sub: r.subPath(name)}
+	if err := res.Open(r.Codec); err != nil {
+		return nil, err
+	}
+	addSub(r, res, name)
+	return res, nil
+}
+
+func (r *Remote) Keys() ([]string, error) {
+	r.panicIfClosed()
+	buf, _, err := r.do(http.MethodGet, "/keys", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	return res, json.Unmarshal(buf, &res)
+}
+
+func (r *Remote) Load(key string, val interface{}) error {
+	_, err := r.LoadETag(key, val)
+	return err
+}
+
+// LoadETag is Load, and also returns the ETag of key for use with
+// SaveETag.
+func (r *Remote) LoadETag(key string, val interface{}) (string, error) {
+	buf, etag, err := r.loadRaw(key)
+	if err != nil {
+		return "", err
+	}
+	if err := r.Decode(buf, val); err != nil {
+		return "", decodeError(r.URL, key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(r.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := r.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return etag, nil
+}
+
+// loadRaw loads key encoded with the Codec of r, along with its ETag.
+func (r *Remote) loadRaw(key string) ([]byte, string, error) {
+	r.panicIfClosed()
+	buf, hdrs, err := r.do(http.MethodGet, "/values/"+url.PathEscape(key), key, nil, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	if buf, err = fromJSON(r.Codec, buf); err != nil {
+		return nil, "", err
+	}
+	return buf, hdrs.Get("ETag"), nil
+}
+
+func (r *Remote) LoadRaw(key string) ([]byte, error) {
+	buf, _, err := r.loadRaw(key)
+	return buf, err
+}
+
+func (r *Remote) Save(key string, val interface{}) error {
+	_, err := r.save(key, val, nil)
+	return err
+}
+
+func (r *Remote) SaveRaw(key string, buf []byte) error {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := rawToJSON(r.Codec, buf)
+	if err != nil {
+		return err
+	}
+	_, err = r.put(key, buf, nil)
+	return err
+}
+
+func (r *Remote) save(key string, val interface{}, hdrs map[string]string) (string, error) {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	buf, err := toJSON(r.Codec, val)
+	if err != nil {
+		return "", err
+	}
+	return r.put(key, buf, hdrs)
+}
+
+// put sends buf, which must be JSON, to the server as key.
+func (r *Remote) put(key string, buf []byte, hdrs map[string]string) (string, error) {
+	_, resp, err := r.do(http.MethodPut, "/values/"+url.PathEscape(key), key, buf, hdrs)
+	if err != nil {
+		return "", err
+	}
+	return resp.Get("ETag"), nil
+}
+
+// SaveETag saves val as key only if the ETag of key is still etag,
+// which is usually the ETag returned by LoadETag.  An empty etag means
+// that key must not exist yet.  It returns the new ETag of key, or
+// StaleRevision if key was changed in the meantime.
+func (r *Remote) SaveETag(key string, val interface{}, etag string) (string, error) {
+	hdrs := map[string]string{"If-Match": etag}
+	if etag == "" {
+		hdrs = map[string]string{"If-None-Match": "*"}
+	}
+	return r.save(key, val, hdrs)
+}
+
+func (r *Remote) Remove(key string) error {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return UnWritable(key)
+	}
+	_, _, err := r.do(http.MethodDelete, "/values/"+url.PathEscape(key), key, nil, nil)
+	return err
+}
+
+func (r *Remote) MetaData() map[string]string {
+	res := map[string]string{}
+	if buf, _, err := r.do(http.MethodGet, "/meta", "", nil, nil); err == nil {
+		json.Unmarshal(buf, &res)
+	}
+	return res
+}
+
+func (r *Remote) SetMetaData(vals map[string]string) error {
+	buf, err := json.Marshal(vals)
+	if err != nil {
+		return err
+	}
+	if _, _, err := r.do(http.MethodPut, "/meta", "", buf, nil); err != nil {
+		return err
+	}
+	if n, ok := vals["Name"]; ok {
+		r.name = n
+	}
+	return nil
+}
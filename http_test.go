@@ -0,0 +1,80 @@
+package store
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRemoteStore(t *testing.T) {
+	backing, _ := Open("memory:///")
+	server := &HTTPServer{Store: backing, Token: "sekrit"}
+	mux := http.NewServeMux()
+	mux.Handle("/store/", http.StripPrefix("/store", server))
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	if _, err := Open(srv.URL + "/store/?token=wrong"); err == nil {
+		t.Errorf("Expected a bad token to be rejected")
+	}
+	loc := srv.URL + "/store/?token=sekrit"
+	s, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open remote store: %v", err)
+	}
+	testStore(t, s)
+	if err := s.(MetaSaver).SetMetaData(map[string]string{"Name": "remote"}); err != nil {
+		t.Errorf("Failed to set metadata: %v", err)
+	}
+	s.Close()
+
+	s, err = Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to reopen remote store: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "remote" || backing.Name() != "remote" {
+		t.Errorf("Metadata was not saved to the served store")
+	}
+	if s.GetSub("sub1") == nil || s.GetSub("sub1").GetSub("sub2") == nil {
+		t.Errorf("Substores did not persist")
+	}
+	if err := s.Save("a/b?c", &bigVal{ID: 1<<62 + 1, Neg: -1<<62 - 1}); err != nil {
+		t.Errorf("Failed to save key with odd characters: %v", err)
+	}
+	big := &bigVal{}
+	if err := s.Load("a/b?c", big); err != nil || big.ID != 1<<62+1 || big.Neg != -1<<62-1 {
+		t.Errorf("Value did not round trip exactly: %v, %v", big, err)
+	}
+
+	r := s.(*Remote)
+	testETagStore(t, r)
+	testConvertedRaw(t, r)
+
+	server.MaxBody = 64
+	if err := s.Save("big", &TestVal{Name: strings.Repeat("x", 100)}); err == nil || !strings.Contains(err.Error(), "413") {
+		t.Errorf("Expected saving a value larger than MaxBody to fail, got %v", err)
+	}
+	if err := s.Save("small", &TestVal{Name: "small"}); err != nil {
+		t.Errorf("Failed to save a value smaller than MaxBody: %v", err)
+	}
+	server.MaxBody = 0
+
+	server.ReadOnly = true
+	ro, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open read-only remote store: %v", err)
+	}
+	defer ro.Close()
+	if !ro.ReadOnly() {
+		t.Errorf("Expected remote store to be read-only")
+	}
+	val := &TestVal{}
+	if err := ro.Load("cas", val); err != nil || val.Name != "new" {
+		t.Errorf("Failed to load from read-only remote store: %v", err)
+	}
+	if err := s.Save("cas", &TestVal{Name: "denied"}); err != UnWritable("cas") {
+		t.Errorf("Expected the server to refuse writes, got %v", err)
+	}
+}
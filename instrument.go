@@ -0,0 +1,111 @@
+package store
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// LogMiddleware returns a Middleware that logs every operation to
+// logger.  Successful operations are logged at Debug level, and
+// failed ones at Warn level.
+func LogMiddleware(logger *slog.Logger) Middleware {
+	return func(c *Call, next Handler) error {
+		start := time.Now()
+		err := next(c)
+		attrs := []slog.Attr{
+			slog.String("op", string(c.Op)),
+			slog.String("type", c.Store.Type()),
+			slog.String("name", c.Store.Name()),
+			slog.Duration("duration", time.Since(start)),
+		}
+		if c.Key != "" {
+			attrs = append(attrs, slog.String("key", c.Key))
+		}
+		level := slog.LevelDebug
+		if err != nil {
+			level = slog.LevelWarn
+			attrs = append(attrs, slog.String("error", err.Error()))
+		}
+		logger.LogAttrs(c.Context, level, "store operation", attrs...)
+		return err
+	}
+}
+
+// OpStats holds the counters Metrics keeps for each operation.
+type OpStats struct {
+	Count   uint64
+	Errors  uint64
+	Latency time.Duration
+}
+
+// Metrics counts operations, failures, and total latency for each
+// operation that passes through its Middleware.
+type Metrics struct {
+	sync.Mutex
+	ops map[Op]*OpStats
+}
+
+// Middleware returns a Middleware that records into m.
+func (m *Metrics) Middleware() Middleware {
+	return func(c *Call, next Handler) error {
+		start := time.Now()
+		err := next(c)
+		elapsed := time.Since(start)
+		m.Lock()
+		defer m.Unlock()
+		if m.ops == nil {
+			m.ops = map[Op]*OpStats{}
+		}
+		st, ok := m.ops[c.Op]
+		if !ok {
+			st = &OpStats{}
+			m.ops[c.Op] = st
+		}
+		st.Count++
+		st.Latency += elapsed
+		if err != nil {
+			st.Errors++
+		}
+		return err
+	}
+}
+
+// Stats returns a copy of the counters recorded so far.
+func (m *Metrics) Stats() map[Op]OpStats {
+	m.Lock()
+	defer m.Unlock()
+	res := map[Op]OpStats{}
+	for k, v := range m.ops {
+		res[k] = *v
+	}
+	return res
+}
+
+// TraceMiddleware returns a Middleware that records a span from
+// tracer for every operation.  Spans are named store.<op>, are
+// children of any span in Call.Context, which can be set with
+// WithContext, and failed operations have the error recorded and
+// their status set to Error.
+func TraceMiddleware(tracer trace.Tracer) Middleware {
+	return func(c *Call, next Handler) error {
+		ctx, span := tracer.Start(c.Context, "store."+string(c.Op),
+			trace.WithAttributes(
+				attribute.String("store.type", c.Store.Type()),
+				attribute.String("store.name", c.Store.Name()),
+				attribute.String("store.key", c.Key),
+			))
+		defer span.End()
+		c.Context = ctx
+		err := next(c)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -112,13 +112,21 @@ type BundleSetter interface {
 	SetBundle(string)
 }
 
-func load(s Store, k KeySaver, key string, runhook bool) (bool, error) {
-	err := s.Load(key, k)
+func load(ctx *HookContext, k KeySaver, key string, runhook bool) (bool, error) {
+	err := ctx.Store.Load(key, k)
 	if err != nil {
 		return false, err
 	}
-	if h, ok := k.(LoadHooker); runhook && ok {
-		return true, h.OnLoad()
+	if !runhook {
+		return true, nil
+	}
+	if h, ok := k.(LoadHooker); ok {
+		if err := h.OnLoad(); err != nil {
+			return true, err
+		}
+	}
+	if h, ok := k.(LoadContextHooker); ok {
+		return true, h.OnLoadContext(ctx)
 	}
 	return true, nil
 }
@@ -126,18 +134,28 @@ func load(s Store, k KeySaver, key string, runhook bool) (bool, error) {
 // List returns a slice of KeySavers, which can then be cast
 // back to whatever type is appropriate by the calling code.
 func List(s Store, ref KeySaver) ([]KeySaver, error) {
+	return ListWith(s, ref, nil)
+}
+
+// ListWith is List, with vals made available to the hooks in
+// HookContext.Values.
+func ListWith(s Store, ref KeySaver, vals map[string]interface{}) ([]KeySaver, error) {
+	ctx := newHookContext(s, OpList, vals)
 	keys, err := s.Keys()
 	if err != nil {
 		return nil, err
 	}
 	res := make([]KeySaver, len(keys))
-	for i, k := range keys {
-		v := ref.New()
-		ok, err := load(s, v, k, true)
-		if !ok {
+	for i, key := range keys {
+		var loaded bool
+		err := intercept(ctx, ref.New(), func(v KeySaver) (err error) {
+			loaded, err = load(ctx, v, key, true)
+			res[i] = v
+			return
+		})
+		if !loaded {
 			return nil, err
 		}
-		res[i] = v
 	}
 	return res, nil
 }
@@ -146,44 +164,110 @@ func List(s Store, ref KeySaver) ([]KeySaver, error) {
 // whether the value was loaded, and error contains the last error
 // that occurred during the load process.
 func Load(s Store, k KeySaver) (bool, error) {
-	return load(s, k, k.Key(), true)
+	return LoadWith(s, k, nil)
+}
+
+// LoadWith is Load, with vals made available to the hooks in
+// HookContext.Values.
+func LoadWith(s Store, k KeySaver, vals map[string]interface{}) (bool, error) {
+	ctx := newHookContext(s, OpLoad, vals)
+	var loaded bool
+	err := intercept(ctx, k, func(k KeySaver) (err error) {
+		loaded, err = load(ctx, k, k.Key(), true)
+		return
+	})
+	return loaded, err
 }
 
 // Remove removes k from s.  The bool indicates whether the value was
 // removed, and the error contains the last error that occurred during
 // the removal process.
 func Remove(s Store, k KeySaver) (bool, error) {
+	return RemoveWith(s, k, nil)
+}
+
+// RemoveWith is Remove, with vals made available to the hooks in
+// HookContext.Values.
+func RemoveWith(s Store, k KeySaver, vals map[string]interface{}) (bool, error) {
+	ctx := newHookContext(s, OpRemove, vals)
+	var removed bool
+	err := intercept(ctx, k, func(k KeySaver) (err error) {
+		removed, err = remove(ctx, k)
+		return
+	})
+	return removed, err
+}
+
+func remove(ctx *HookContext, k KeySaver) (bool, error) {
 	if h, ok := k.(BeforeDeleteHooker); ok {
 		if err := h.BeforeDelete(); err != nil {
 			return false, err
 		}
 	}
-	if err := s.Remove(k.Key()); err != nil {
+	if h, ok := k.(BeforeDeleteContextHooker); ok {
+		if err := h.BeforeDeleteContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	if err := ctx.Store.Remove(k.Key()); err != nil {
 		return false, err
 	}
 	if h, ok := k.(AfterDeleteHooker); ok {
 		h.AfterDelete()
 	}
+	if h, ok := k.(AfterDeleteContextHooker); ok {
+		return true, h.AfterDeleteContext(ctx)
+	}
 	return true, nil
 }
 
-func save(s Store, k KeySaver) (bool, error) {
+func save(ctx *HookContext, k KeySaver) (bool, error) {
 	if h, ok := k.(BeforeSaveHooker); ok {
 		if err := h.BeforeSave(); err != nil {
 			return false, err
 		}
 	}
+	if h, ok := k.(BeforeSaveContextHooker); ok {
+		if err := h.BeforeSaveContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	if err := validate(ctx, k); err != nil {
+		return false, err
+	}
 	toSave := k
 	if alt, ok := k.(SaveCleanHooker); ok {
 		toSave = alt.SaveClean()
 	}
-	if err := s.Save(toSave.Key(), toSave); err != nil {
+	if ctx.etag != nil {
+		_, err := ctx.Store.(ETagStore).SaveETag(toSave.Key(), toSave, *ctx.etag)
+		if _, ok := err.(StaleRevision); ok {
+			return false, PatchConflict(fmt.Sprintf("%s:%s was changed", toSave.Prefix(), toSave.Key()))
+		}
+		if err != nil {
+			return false, err
+		}
+	} else if err := ctx.Store.Save(toSave.Key(), toSave); err != nil {
 		return false, err
 	}
 	if h, ok := k.(AfterSaveHooker); ok {
 		h.AfterSave()
 	}
-
+	if h, ok := k.(AfterSaveContextHooker); ok {
+		if err := h.AfterSaveContext(ctx); err != nil {
+			return true, err
+		}
+	}
+	switch ctx.Op {
+	case OpCreate:
+		if h, ok := k.(AfterCreateHooker); ok {
+			return true, h.AfterCreate(ctx)
+		}
+	case OpUpdate, OpPatch:
+		if h, ok := k.(AfterUpdateHooker); ok {
+			return true, h.AfterUpdate(ctx)
+		}
+	}
 	return true, nil
 }
 
@@ -191,15 +275,43 @@ func save(s Store, k KeySaver) (bool, error) {
 // The bool indicates that the object was saved, and the error
 // contains the last error that occurred..
 func Save(s Store, k KeySaver) (bool, error) {
-	return save(s, k)
+	return SaveWith(s, k, nil)
+}
+
+// SaveWith is Save, with vals made available to the hooks in
+// HookContext.Values.
+func SaveWith(s Store, k KeySaver, vals map[string]interface{}) (bool, error) {
+	ctx := newHookContext(s, OpSave, vals)
+	var saved bool
+	err := intercept(ctx, k, func(k KeySaver) (err error) {
+		saved, err = save(ctx, k)
+		return
+	})
+	return saved, err
 }
 
 // Create saves k in s, with the caveat that k must not already be
 // present in s.  The bool indicates that the object was saved, and
 // the error indicates the last error that occurred.
 func Create(s Store, k KeySaver) (bool, error) {
+	return CreateWith(s, k, nil)
+}
+
+// CreateWith is Create, with vals made available to the hooks in
+// HookContext.Values.
+func CreateWith(s Store, k KeySaver, vals map[string]interface{}) (bool, error) {
+	ctx := newHookContext(s, OpCreate, vals)
+	var saved bool
+	err := intercept(ctx, k, func(k KeySaver) (err error) {
+		saved, err = create(ctx, k)
+		return
+	})
+	return saved, err
+}
+
+func create(ctx *HookContext, k KeySaver) (bool, error) {
 	v := k.New()
-	if ok, _ := load(s, v, k.Key(), false); ok {
+	if ok, _ := load(ctx, v, k.Key(), false); ok {
 		return false, fmt.Errorf("Create: thing %s:%s already exists", k.Prefix(), k.Key())
 	}
 	if h, ok := k.(CreateHooker); ok {
@@ -207,21 +319,53 @@ func Create(s Store, k KeySaver) (bool, error) {
 			return false, err
 		}
 	}
-	return save(s, k)
+	if h, ok := k.(CreateContextHooker); ok {
+		if err := h.OnCreateContext(ctx); err != nil {
+			return false, err
+		}
+	}
+	return save(ctx, k)
+}
+
+func change(ctx *HookContext, k KeySaver) error {
+	if h, ok := k.(ChangeHooker); ok {
+		if err := h.OnChange(ctx.Previous); err != nil {
+			return err
+		}
+	}
+	if h, ok := k.(ChangeContextHooker); ok {
+		return h.OnChangeContext(ctx)
+	}
+	return nil
 }
 
 // Update saves k in s, with the caveat that s must already contain an
 // older version of k.  If k implements ChangeHooker, then it will be
 // called with the version that already exists in the backing store.
 func Update(s Store, k KeySaver) (bool, error) {
+	return UpdateWith(s, k, nil)
+}
+
+// UpdateWith is Update, with vals made available to the hooks in
+// HookContext.Values.
+func UpdateWith(s Store, k KeySaver, vals map[string]interface{}) (bool, error) {
+	ctx := newHookContext(s, OpUpdate, vals)
+	var saved bool
+	err := intercept(ctx, k, func(k KeySaver) (err error) {
+		saved, err = update(ctx, k)
+		return
+	})
+	return saved, err
+}
+
+func update(ctx *HookContext, k KeySaver) (bool, error) {
 	v := k.New()
-	if ok, _ := load(s, v, k.Key(), false); !ok {
+	if ok, _ := load(ctx, v, k.Key(), false); !ok {
 		return false, fmt.Errorf("Update: %s:%s does not already exist", k.Prefix(), k.Key())
 	}
-	if h, ok := k.(ChangeHooker); ok {
-		if err := h.OnChange(v); err != nil {
-			return false, err
-		}
+	ctx.Previous = v
+	if err := change(ctx, k); err != nil {
+		return false, err
 	}
-	return save(s, k)
+	return save(ctx, k)
 }
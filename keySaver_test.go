@@ -238,7 +238,7 @@ func testPersistent(t *testing.T, storeType, storeCodec string) {
 	t.Logf("Running in %s", tmpDir)
 	defer os.RemoveAll(tmpDir)
 	var storeLoc string
-	if storeType == "file" {
+	if storeType == "file" || storeType == "sqlite" {
 		storeLoc = path.Join(tmpDir, "data."+storeCodec)
 	} else {
 		storeLoc = tmpDir
@@ -282,17 +282,33 @@ func testPersistent(t *testing.T, storeType, storeCodec string) {
 	}
 	t.Log("Testing copy capabilities")
 	dst, _ := Open("memory:///")
-	if err := Copy(dst, s); err != nil {
+	if err := Copy(dst, s); storeCodec == "gob" {
+		if err == nil {
+			t.Errorf("Expected copying gob values to another codec to fail")
+		}
+		dst, _ = Open("memory:///?codec=gob")
+		if err := Copy(dst, s); err != nil {
+			t.Errorf("Error copying stores: %v", err)
+		}
+	} else if err != nil {
 		t.Errorf("Error copying stores: %v", err)
 	}
 	t.Logf("Persistent test finished")
 }
 
 func TestPersistentStores(t *testing.T) {
-	storeCodecs := []string{"json", "yaml", "default"}
-	storeType := []string{"bolt", "directory", "file"}
+	storeCodecs := []string{"json", "yaml", "default", "json+gzip", "yaml+zstd",
+		"cbor", "msgpack", "toml", "gob", "yamlv3"}
+	storeType := []string{"bolt", "directory", "file", "sqlite", "git"}
 	for _, codec := range storeCodecs {
 		for _, storeType := range storeType {
+			if codec == "gob" && storeType == "file" {
+				// gob cannot decode into interface{}
+				if _, err := Open("file:" + path.Join(os.TempDir(), "store-refused.gob") + "?codec=gob"); err == nil {
+					t.Errorf("Expected a file store to refuse the gob codec")
+				}
+				continue
+			}
 			t.Logf("Testing persistent store %s with codec %s", storeType, codec)
 			testPersistent(t, storeType, codec)
 			t.Logf("--------------------------------------------------------")
@@ -302,3 +318,48 @@ func TestPersistentStores(t *testing.T) {
 		}
 	}
 }
+
+type bigVal struct {
+	ID  int64
+	Neg int64
+}
+
+func TestLosslessNumbers(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	big := bigVal{ID: 1<<62 + 1, Neg: -(1 << 60) - 3}
+	for _, codec := range []string{"json", "yaml", "yamlv3", "canonical", "json+gzip", "cbor", "msgpack", "toml"} {
+		fileName := path.Join(tmpDir, "file-"+codec)
+		src, err := Open("file:" + fileName + "?codec=" + codec)
+		if err != nil {
+			t.Fatalf("%s: Failed to open file store: %v", codec, err)
+		}
+		if err := src.Save("big", big); err != nil {
+			t.Fatalf("%s: Failed to save: %v", codec, err)
+		}
+		// Saving another key re-encodes big along with it.
+		if err := src.Save("other", big); err != nil {
+			t.Fatalf("%s: Failed to save: %v", codec, err)
+		}
+		src.Close()
+		src, err = Open("file:" + fileName + "?codec=" + codec)
+		if err != nil {
+			t.Fatalf("%s: Failed to reopen file store: %v", codec, err)
+		}
+		dst, _ := Open("directory:" + path.Join(tmpDir, "dir-"+codec))
+		if err := Copy(dst, src); err != nil {
+			t.Fatalf("%s: Failed to copy: %v", codec, err)
+		}
+		for _, s := range []Store{src, dst} {
+			loaded := bigVal{}
+			if err := s.Load("big", &loaded); err != nil {
+				t.Errorf("%s: Failed to load from %s: %v", codec, s.Type(), err)
+			} else if loaded != big {
+				t.Errorf("%s: %s store changed %#v into %#v", codec, s.Type(), big, loaded)
+			}
+		}
+	}
+}
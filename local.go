@@ -3,6 +3,8 @@ package store
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
@@ -189,22 +191,36 @@ func (b *Bolt) Keys() ([]string, error) {
 	return res, err
 }
 
-func (b *Bolt) Load(key string, val interface{}) error {
+func (b *Bolt) LoadRaw(key string) ([]byte, error) {
 	b.panicIfClosed()
 	var res []byte
 	err := b.db.View(func(tx *bolt.Tx) error {
 		bucket := b.getBucket(tx)
-		res = bucket.Get([]byte(key))
-		if res == nil {
+		v := bucket.Get([]byte(key))
+		if v == nil {
 			return os.ErrNotExist
 		}
+		// v is only valid for the life of the transaction.
+		res = append([]byte{}, v...)
 		return nil
 	})
+	return res, err
+}
+
+func (b *Bolt) Load(key string, val interface{}) error {
+	_, err := b.LoadETag(key, val)
+	return err
+}
+
+// LoadETag is Load, and also returns the ETag of key for use with
+// SaveETag.
+func (b *Bolt) LoadETag(key string, val interface{}) (string, error) {
+	res, err := b.LoadRaw(key)
 	if err != nil {
-		return err
+		return "", err
 	}
 	if err := b.Decode(res, val); err != nil {
-		return err
+		return "", decodeError(b.Path, key, err)
 	}
 	if ro, ok := val.(ReadOnlySetter); ok {
 		ro.SetReadOnly(b.ReadOnly())
@@ -215,7 +231,7 @@ func (b *Bolt) Load(key string, val interface{}) error {
 			bb.SetBundle(n)
 		}
 	}
-	return nil
+	return valueETag(res), nil
 }
 
 func (b *Bolt) Save(key string, val interface{}) error {
@@ -227,12 +243,66 @@ func (b *Bolt) Save(key string, val interface{}) error {
 	if err != nil {
 		return err
 	}
+	return b.SaveRaw(key, buf)
+}
+
+func (b *Bolt) SaveRaw(key string, buf []byte) error {
+	b.panicIfClosed()
+	if b.ReadOnly() {
+		return UnWritable(key)
+	}
 	return b.db.Update(func(tx *bolt.Tx) error {
 		bucket := b.getBucket(tx)
 		return bucket.Put([]byte(key), buf)
 	})
 }
 
+// SaveETag saves val as key only if the ETag of key is still etag,
+// which is usually the ETag returned by LoadETag.  An empty etag means
+// that key must not exist yet.  The check and the save happen in one
+// transaction.  It returns the new ETag of key, or StaleRevision if key
+// was changed in the meantime.
+func (b *Bolt) SaveETag(key string, val interface{}, etag string) (string, error) {
+	b.panicIfClosed()
+	if b.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	buf, err := b.Encode(val)
+	if err != nil {
+		return "", err
+	}
+	err = b.db.Update(func(tx *bolt.Tx) error {
+		bucket := b.getBucket(tx)
+		cur := bucket.Get([]byte(key))
+		if (cur == nil && etag != "") || (cur != nil && valueETag(cur) != etag) {
+			return StaleRevision(key)
+		}
+		return bucket.Put([]byte(key), buf)
+	})
+	if err != nil {
+		return "", err
+	}
+	return valueETag(buf), nil
+}
+
+// SaveStream reads all of r into memory and saves it as key, as Bolt
+// can only store values that are held in memory.
+func (b *Bolt) SaveStream(key string, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return b.SaveRaw(key, buf)
+}
+
+func (b *Bolt) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := b.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
 func (b *Bolt) Remove(key string) error {
 	b.panicIfClosed()
 	if b.ReadOnly() {
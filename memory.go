@@ -1,6 +1,11 @@
 package store
 
-import "os"
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
 
 // MemoryStore provides an in-memory implementation of Store
 // for testing purposes
@@ -84,17 +89,25 @@ func (m *Memory) Keys() ([]string, error) {
 	return res, nil
 }
 
-func (m *Memory) Load(key string, val interface{}) error {
+func (m *Memory) LoadRaw(key string) ([]byte, error) {
 	m.RLock()
+	defer m.RUnlock()
 	m.panicIfClosed()
 	v, ok := m.v[key]
-	m.RUnlock()
 	if !ok {
-		return os.ErrNotExist
+		return nil, os.ErrNotExist
 	}
-	if err := m.Decode(v, val); err != nil {
+	return append([]byte{}, v...), nil
+}
+
+func (m *Memory) Load(key string, val interface{}) error {
+	v, err := m.LoadRaw(key)
+	if err != nil {
 		return err
 	}
+	if err := m.Decode(v, val); err != nil {
+		return decodeError("", key, err)
+	}
 	if ro, ok := val.(ReadOnlySetter); ok {
 		ro.SetReadOnly(m.ReadOnly())
 	}
@@ -122,6 +135,17 @@ func (m *Memory) Save(key string, val interface{}) error {
 	return nil
 }
 
+func (m *Memory) SaveRaw(key string, buf []byte) error {
+	m.Lock()
+	defer m.Unlock()
+	m.panicIfClosed()
+	if m.readOnly {
+		return UnWritable(key)
+	}
+	m.v[key] = append([]byte{}, buf...)
+	return nil
+}
+
 func (m *Memory) Remove(key string) error {
 	m.Lock()
 	defer m.Unlock()
@@ -136,3 +160,20 @@ func (m *Memory) Remove(key string) error {
 	}
 	return os.ErrNotExist
 }
+
+// SaveStream reads all of r into memory and saves it as key.
+func (m *Memory) SaveStream(key string, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.SaveRaw(key, buf)
+}
+
+func (m *Memory) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := m.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
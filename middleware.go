@@ -0,0 +1,241 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Store-level operations that can pass through a Middleware, in
+// addition to OpLoad, OpSave, and OpRemove.
+const (
+	OpKeys    Op = "keys"
+	OpMakeSub Op = "makesub"
+	OpSetMeta Op = "setmeta"
+)
+
+// Call describes a single operation against a wrapped Store.  Store is
+// the underlying Store the operation will run against.  Key is the key
+// for OpLoad, OpSave, and OpRemove, and the name of the substore for
+// OpMakeSub.  Val is the value being loaded or saved, or the metadata
+// being set for OpSetMeta.  Once the operation has run, Keys holds the
+// result of OpKeys and Sub holds the result of OpMakeSub.
+//
+// Context is the context the operation runs in, which is the one
+// given to WithContext, or context.Background().  A Middleware can
+// replace it before calling next to pass values to the ones after it.
+type Call struct {
+	Op      Op
+	Store   Store
+	Key     string
+	Val     interface{}
+	Keys    []string
+	Sub     Store
+	Context context.Context
+}
+
+// Handler performs a Call.
+type Handler func(*Call) error
+
+// Middleware intercepts operations on a wrapped Store.  It must call
+// next for the operation to proceed, and it can inspect the Call and
+// the returned error once next returns.
+type Middleware func(c *Call, next Handler) error
+
+// Wrapped is implemented by Stores returned by Wrap.
+type Wrapped interface {
+	Store
+	// Unwrap returns the Store that was wrapped.
+	Unwrap() Store
+}
+
+// Wrap returns a Store that runs each Keys, Load, Save, Remove,
+// MakeSub and SetMetaData call on s through mws.  The first Middleware
+// is the outermost one.  Substores of the returned Store are wrapped
+// with the same Middleware.  If s is a MetaSaver or a StackedStore, the
+// returned Store provides the same methods.  It is never a RawStore,
+// StreamStore, or ETagStore, since their methods would bypass mws, so
+// Copy, Cache, and the like load and save values through it instead;
+// use Unwrap to reach those methods of s.
+func Wrap(s Store, mws ...Middleware) Store {
+	return wrap(s, mws, nil, nil)
+}
+
+// WithContext returns a Store that runs the operations of s in ctx.
+// If s was returned by Wrap, its Middleware see ctx as Call.Context,
+// as do those of its substores, and the hooks run by the KeySaver
+// functions on the returned Store see it as HookContext.Context.
+// Otherwise, s is wrapped with no Middleware so that the hooks still
+// see ctx.
+func WithContext(s Store, ctx context.Context) Store {
+	if w, ok := s.(wrapper); ok {
+		b := w.base()
+		return wrap(b.Store, b.mws, b.parent, ctx)
+	}
+	return wrap(s, nil, nil, ctx)
+}
+
+// contextOf returns the context operations on s run in.
+func contextOf(s Store) context.Context {
+	if w, ok := s.(wrapper); ok && w.base().ctx != nil {
+		return w.base().ctx
+	}
+	return context.Background()
+}
+
+// wrapper is implemented by the Stores wrap returns.
+type wrapper interface {
+	base() *wrapped
+}
+
+func wrap(s Store, mws []Middleware, parent Store, ctx context.Context) Store {
+	w := &wrapped{Store: s, mws: mws, parent: parent, ctx: ctx, subs: map[Store]Store{}}
+	switch s.(type) {
+	case *StackedStore:
+		w.outer = &wrappedStack{w}
+	case MetaSaver:
+		w.outer = &wrappedMeta{w}
+	default:
+		w.outer = w
+	}
+	return w.outer
+}
+
+type wrapped struct {
+	Store
+	mws    []Middleware
+	parent Store
+	outer  Store
+	ctx    context.Context
+	subMux sync.Mutex
+	subs   map[Store]Store
+}
+
+func (w *wrapped) Unwrap() Store {
+	return w.Store
+}
+
+func (w *wrapped) base() *wrapped {
+	return w
+}
+
+func (w *wrapped) run(c *Call, final Handler) error {
+	c.Store = w.Store
+	c.Context = contextOf(w)
+	var call func(int, *Call) error
+	call = func(i int, c *Call) error {
+		if i == len(w.mws) {
+			return final(c)
+		}
+		return w.mws[i](c, func(c *Call) error {
+			return call(i+1, c)
+		})
+	}
+	return call(0, c)
+}
+
+func (w *wrapped) wrapSub(sub Store) Store {
+	if sub == nil {
+		return nil
+	}
+	w.subMux.Lock()
+	defer w.subMux.Unlock()
+	if res, ok := w.subs[sub]; ok {
+		return res
+	}
+	res := wrap(sub, w.mws, w.outer, w.ctx)
+	w.subs[sub] = res
+	return res
+}
+
+func (w *wrapped) Parent() Store {
+	if w.parent != nil {
+		return w.parent
+	}
+	return w.Store.Parent()
+}
+
+func (w *wrapped) GetSub(name string) Store {
+	return w.wrapSub(w.Store.GetSub(name))
+}
+
+func (w *wrapped) Subs() map[string]Store {
+	res := w.Store.Subs()
+	for k, v := range res {
+		res[k] = w.wrapSub(v)
+	}
+	return res
+}
+
+func (w *wrapped) MakeSub(name string) (Store, error) {
+	c := &Call{Op: OpMakeSub, Key: name}
+	err := w.run(c, func(c *Call) (err error) {
+		c.Sub, err = c.Store.MakeSub(c.Key)
+		return
+	})
+	if err != nil {
+		return nil, err
+	}
+	return w.wrapSub(c.Sub), nil
+}
+
+func (w *wrapped) Keys() ([]string, error) {
+	c := &Call{Op: OpKeys}
+	err := w.run(c, func(c *Call) (err error) {
+		c.Keys, err = c.Store.Keys()
+		return
+	})
+	return c.Keys, err
+}
+
+func (w *wrapped) Load(key string, val interface{}) error {
+	return w.run(&Call{Op: OpLoad, Key: key, Val: val}, func(c *Call) error {
+		return c.Store.Load(c.Key, c.Val)
+	})
+}
+
+func (w *wrapped) Save(key string, val interface{}) error {
+	return w.run(&Call{Op: OpSave, Key: key, Val: val}, func(c *Call) error {
+		return c.Store.Save(c.Key, c.Val)
+	})
+}
+
+func (w *wrapped) Remove(key string) error {
+	return w.run(&Call{Op: OpRemove, Key: key}, func(c *Call) error {
+		return c.Store.Remove(c.Key)
+	})
+}
+
+type wrappedMeta struct {
+	*wrapped
+}
+
+func (w *wrappedMeta) MetaData() map[string]string {
+	return w.Store.(MetaSaver).MetaData()
+}
+
+func (w *wrappedMeta) SetMetaData(vals map[string]string) error {
+	return w.run(&Call{Op: OpSetMeta, Val: vals}, func(c *Call) error {
+		vals, ok := c.Val.(map[string]string)
+		if !ok {
+			return fmt.Errorf("SetMetaData: %T is not a map[string]string", c.Val)
+		}
+		return c.Store.(MetaSaver).SetMetaData(vals)
+	})
+}
+
+type wrappedStack struct {
+	*wrapped
+}
+
+func (w *wrappedStack) Push(layer Store, keysCannotBeOverridden, keysCannotOverride bool) error {
+	return w.Store.(*StackedStore).Push(layer, keysCannotBeOverridden, keysCannotOverride)
+}
+
+func (w *wrappedStack) Layers() []Store {
+	return w.Store.(*StackedStore).Layers()
+}
+
+func (w *wrappedStack) MetaFor(key string) map[string]string {
+	return w.Store.(*StackedStore).MetaFor(key)
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWrappedStore(t *testing.T) {
+	base, _ := Open("memory:///")
+	metrics := &Metrics{}
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	s := Wrap(base, LogMiddleware(logger), metrics.Middleware())
+	if _, ok := s.(MetaSaver); !ok {
+		t.Errorf("Wrapped memory store should be a MetaSaver")
+	}
+	testStore(t, s)
+	if sub := s.GetSub("sub1"); sub == nil {
+		t.Errorf("Missing wrapped substore sub1")
+	} else if _, ok := sub.(Wrapped); !ok {
+		t.Errorf("Substore sub1 is not wrapped")
+	} else if sub.Parent() != s {
+		t.Errorf("Substore sub1 does not have the wrapped store as its parent")
+	}
+	stats := metrics.Stats()
+	for _, op := range []Op{OpKeys, OpLoad, OpSave, OpRemove, OpMakeSub} {
+		if stats[op].Count == 0 {
+			t.Errorf("No %s operations recorded", op)
+		}
+	}
+	if stats[OpSave].Errors == 0 {
+		t.Errorf("Expected read-only saves to be recorded as errors")
+	}
+	if !strings.Contains(buf.String(), "op=save") {
+		t.Errorf("Expected save operations to be logged")
+	}
+}
+
+func TestWrappedStack(t *testing.T) {
+	tobj := struct{ Foo, Bar string }{"foo", "bar"}
+	s1, _ := Open("memory://")
+	s2, _ := Open("memory://")
+	s2.Save("foo", &tobj)
+	st := &StackedStore{}
+	st.Open(nil)
+	metrics := &Metrics{}
+	ws := Wrap(st, metrics.Middleware())
+	stack, ok := ws.(interface {
+		Push(Store, bool, bool) error
+		Layers() []Store
+	})
+	if !ok {
+		t.Fatalf("Wrapped StackedStore does not provide Push and Layers")
+	}
+	if err := stack.Push(s1, false, false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if err := stack.Push(s2, false, false); err != nil {
+		t.Fatalf("Push failed: %v", err)
+	}
+	if len(stack.Layers()) != 2 {
+		t.Errorf("Expected 2 layers, got %d", len(stack.Layers()))
+	}
+	var tgt interface{}
+	checkErr(t, nil, ws.Load("foo", &tgt))
+	checkErr(t, UnWritable(""), ws.Remove("foo"))
+	if metrics.Stats()[OpRemove].Errors != 1 {
+		t.Errorf("Expected one failed remove to be recorded")
+	}
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)).Tracer("test")
+	base, _ := Open("memory:///")
+	ws := Wrap(base, TraceMiddleware(tracer))
+	ctx, parent := tracer.Start(context.Background(), "request")
+	s := WithContext(ws, ctx)
+	if err := s.Save("a", &TestVal{Name: "a"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	sub, _ := s.MakeSub("sub")
+	sub.Load("a", &TestVal{})
+	if hc := newHookContext(sub, OpLoad, nil); hc.Context != ctx {
+		t.Errorf("Expected hooks to see the context given to WithContext")
+	}
+	parent.End()
+	ws.Load("a", &TestVal{})
+
+	spans := rec.Ended()
+	if len(spans) != 5 {
+		t.Fatalf("Expected 5 spans, got %d", len(spans))
+	}
+	for _, span := range spans[:3] {
+		if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+			t.Errorf("Expected %s to be a child of the caller's span", span.Name())
+		}
+	}
+	if spans[4].Parent().IsValid() {
+		t.Errorf("Expected an operation without a context to start a new trace")
+	}
+}
@@ -0,0 +1,153 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+// PatchConflict is returned by Patch when a JSON Patch test operation
+// fails, or when the object in the Store changed while the patch was
+// being applied.
+type PatchConflict string
+
+func (p PatchConflict) Error() string {
+	return fmt.Sprintf("patch conflict: %s", string(p))
+}
+
+// StaleRevision is returned by the SaveETag method of an ETagStore
+// when key was changed, created, or removed after the ETag it was
+// passed was read.
+type StaleRevision string
+
+func (s StaleRevision) Error() string {
+	return fmt.Sprintf("key %s: changed since it was loaded", string(s))
+}
+
+// ETagStore is implemented by Stores that can save a value only if it
+// has not changed since it was loaded.  LoadETag is Load, and also
+// returns a tag for the value of key.  SaveETag saves val as key only
+// if the tag of key is still etag, where an empty etag means that key
+// must not exist yet, and returns StaleRevision otherwise.  S3, Remote,
+// Etcd, Consul, Bolt, and Sqlite are ETagStores.
+type ETagStore interface {
+	Store
+	LoadETag(key string, val interface{}) (string, error)
+	SaveETag(key string, val interface{}, etag string) (string, error)
+}
+
+func applyPatch(doc, patch []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(patch)
+	if len(trimmed) == 0 {
+		return nil, fmt.Errorf("Empty patch")
+	}
+	switch trimmed[0] {
+	case '{':
+		return jsonpatch.MergePatch(doc, trimmed)
+	case '[':
+		p, err := jsonpatch.DecodePatch(trimmed)
+		if err != nil {
+			return nil, err
+		}
+		res, err := p.Apply(doc)
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			return nil, PatchConflict(err.Error())
+		}
+		return res, err
+	default:
+		return nil, fmt.Errorf("Patch must be a JSON object (RFC 7386) or a JSON array (RFC 6902)")
+	}
+}
+
+// Patch applies patch to the copy of k that is currently in s and
+// saves the result.  patch is either an RFC 7386 JSON merge patch (a
+// JSON object) or an RFC 6902 JSON Patch (a JSON array of
+// operations). Only k.Key() is used to find the object to patch.
+//
+// The patched object gets the same hooks that Update() would run,
+// with the unpatched object passed to OnChange().  If a JSON Patch
+// test operation fails or the object in s changes before the patched
+// copy can be saved, Patch returns a PatchConflict and nothing is
+// saved.  On success, the patched object is returned.
+//
+// If s is an ETagStore, the patched copy is saved with SaveETag, so
+// that no other change to the object can be lost.  Otherwise Patch can
+// only check that the object is unchanged just before it saves it: a
+// change that lands between that check and the save is overwritten.
+func Patch(s Store, k KeySaver, patch []byte) (KeySaver, error) {
+	return PatchWith(s, k, patch, nil)
+}
+
+// PatchWith is Patch, with vals made available to the hooks in
+// HookContext.Values.  Interceptors are run around the patched copy of
+// the object.
+func PatchWith(s Store, k KeySaver, patch []byte, vals map[string]interface{}) (KeySaver, error) {
+	ctx := newHookContext(s, OpPatch, vals)
+	key := k.Key()
+	cur := k.New()
+	var err error
+	if es, ok := s.(ETagStore); ok {
+		var etag string
+		if etag, err = es.LoadETag(key, cur); err == nil {
+			ctx.etag = &etag
+		}
+	} else {
+		_, err = load(ctx, cur, key, false)
+	}
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("Patch: %s:%s does not already exist", k.Prefix(), key)
+	} else if err != nil {
+		return nil, err
+	}
+	ctx.Previous = cur
+	orig, err := json.Marshal(cur)
+	if err != nil {
+		return nil, err
+	}
+	patched, err := applyPatch(orig, patch)
+	if err != nil {
+		return nil, err
+	}
+	res := k.New()
+	if err := json.Unmarshal(patched, res); err != nil {
+		return nil, err
+	}
+	var saved bool
+	err = intercept(ctx, res, func(obj KeySaver) (err error) {
+		res = obj
+		saved, err = patchSave(ctx, obj, orig)
+		return
+	})
+	if !saved {
+		return nil, err
+	}
+	return res, err
+}
+
+func patchSave(ctx *HookContext, k KeySaver, orig []byte) (bool, error) {
+	key := ctx.Previous.Key()
+	if k.Key() != key {
+		return false, fmt.Errorf("Patch: %s:%s cannot change %s to %s", k.Prefix(), key, k.KeyName(), k.Key())
+	}
+	if err := change(ctx, k); err != nil {
+		return false, err
+	}
+	if ctx.etag != nil {
+		// save checks the ETag as it saves.
+		return save(ctx, k)
+	}
+	check := k.New()
+	if ok, _ := load(ctx, check, key, false); !ok {
+		return false, PatchConflict(fmt.Sprintf("%s:%s was removed", k.Prefix(), key))
+	}
+	if now, err := json.Marshal(check); err != nil {
+		return false, err
+	} else if !bytes.Equal(now, orig) {
+		return false, PatchConflict(fmt.Sprintf("%s:%s was changed", k.Prefix(), key))
+	}
+	return save(ctx, k)
+}
@@ -0,0 +1,184 @@
+package store
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestPatch(t *testing.T) {
+	s, _ := Open("memory:///")
+	if ok, err := Create(s, &TestVal{Name: "patched", Val: "orig"}); !ok {
+		t.Fatalf("Failed to create patch target: %v", err)
+	}
+	ref := &TestVal{Name: "patched"}
+	res, err := Patch(s, ref, []byte(`{"Val":"merged"}`))
+	if err != nil {
+		t.Errorf("Merge patch failed: %v", err)
+	} else if res.(*TestVal).Val != "merged" {
+		t.Errorf("Merge patch did not apply: got %q", res.(*TestVal).Val)
+	}
+	res, err = Patch(s, ref, []byte(`[
+  {"op":"test","path":"/Val","value":"merged"},
+  {"op":"replace","path":"/Val","value":"replaced"}
+]`))
+	if err != nil {
+		t.Errorf("JSON patch failed: %v", err)
+	} else if res.(*TestVal).Val != "replaced" {
+		t.Errorf("JSON patch did not apply: got %q", res.(*TestVal).Val)
+	}
+	_, err = Patch(s, ref, []byte(`[
+  {"op":"test","path":"/Val","value":"merged"},
+  {"op":"replace","path":"/Val","value":"stale"}
+]`))
+	if _, ok := err.(PatchConflict); !ok {
+		t.Errorf("Expected PatchConflict from failed test op, got %v", err)
+	}
+	if _, err = Patch(s, ref, []byte(`{"Name":"renamed"}`)); err == nil {
+		t.Errorf("Expected patch changing the key to fail")
+	}
+	if _, err = Patch(s, &TestVal{Name: "missing"}, []byte(`{"Val":"x"}`)); err == nil {
+		t.Errorf("Expected patch of missing object to fail")
+	}
+	loaded := &TestVal{Name: "patched"}
+	if ok, err := Load(s, loaded); !ok {
+		t.Errorf("Failed to load patched object: %v", err)
+	} else if loaded.Val != "replaced" {
+		t.Errorf("Expected stored value to be `replaced`, got %q", loaded.Val)
+	}
+}
+
+// racingVal saves a rival copy of itself to the Store in the "racer"
+// value from BeforeSaveContext, which runs after Patch has checked
+// that the object is unchanged.
+type racingVal struct {
+	Name, Val string
+}
+
+func (r *racingVal) Prefix() string  { return "racing" }
+func (r *racingVal) Key() string     { return r.Name }
+func (r *racingVal) KeyName() string { return "Name" }
+func (r *racingVal) New() KeySaver   { return &racingVal{} }
+
+func (r *racingVal) BeforeSaveContext(ctx *HookContext) error {
+	if racer, ok := ctx.Value("racer").(Store); ok {
+		return racer.Save(r.Name, &racingVal{Name: r.Name, Val: "racer"})
+	}
+	return nil
+}
+
+func TestPatchETag(t *testing.T) {
+	backing, _ := Open("memory:///")
+	srv := httptest.NewServer(&HTTPServer{Store: backing})
+	defer srv.Close()
+	s, err := Open(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("Failed to open remote store: %v", err)
+	}
+	defer s.Close()
+	Create(s, &racingVal{Name: "a", Val: "orig"})
+	ref := &racingVal{Name: "a"}
+	if _, err := Patch(s, ref, []byte(`{"Val":"patched"}`)); err != nil {
+		t.Errorf("Patch failed: %v", err)
+	}
+	vals := map[string]interface{}{"racer": backing}
+	if _, err := PatchWith(s, ref, []byte(`{"Val":"lost"}`), vals); err == nil {
+		t.Errorf("Expected a patch racing another save to fail")
+	} else if _, ok := err.(PatchConflict); !ok {
+		t.Errorf("Expected PatchConflict, got %v", err)
+	}
+	loaded := &racingVal{}
+	if err := backing.Load("a", loaded); err != nil || loaded.Val != "racer" {
+		t.Errorf("Expected the racing save to survive, got %v, %v", loaded, err)
+	}
+}
+
+// testETagStore checks the compare-and-swap behaviour of s with the
+// key cas, which must not exist yet.
+func testETagStore(t *testing.T, s ETagStore) {
+	t.Helper()
+	val := &TestVal{}
+	if _, err := s.LoadETag("cas", val); !os.IsNotExist(err) {
+		t.Fatalf("Expected cas to not exist yet, got %v", err)
+	}
+	etag, err := s.SaveETag("cas", &TestVal{Name: "cas"}, "")
+	if err != nil {
+		t.Fatalf("Failed to create key with SaveETag: %v", err)
+	}
+	if _, err := s.SaveETag("cas", &TestVal{Name: "again"}, ""); err != StaleRevision("cas") {
+		t.Errorf("Expected StaleRevision creating an existing key, got %v", err)
+	}
+	if loaded, err := s.LoadETag("cas", val); err != nil || loaded != etag || val.Name != "cas" {
+		t.Errorf("LoadETag returned %q, %v, %v; expected %q", loaded, val, err, etag)
+	}
+	if _, err := s.SaveETag("cas", &TestVal{Name: "new"}, etag); err != nil {
+		t.Errorf("Failed to save with current ETag: %v", err)
+	}
+	if _, err := s.SaveETag("cas", &TestVal{Name: "newer"}, etag); err != StaleRevision("cas") {
+		t.Errorf("Expected StaleRevision saving with an old ETag, got %v", err)
+	}
+	if _, err := s.LoadETag("cas", val); err != nil || val.Name != "new" {
+		t.Errorf("Unexpected value after CAS: %v, %#v", err, val)
+	}
+}
+
+func TestLocalETagStores(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, loc := range []string{
+		"bolt:" + path.Join(tmpDir, "bolt"),
+		"sqlite:" + path.Join(tmpDir, "store.db"),
+	} {
+		s, err := Open(loc)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", loc, err)
+		}
+		es, ok := s.(ETagStore)
+		if !ok {
+			t.Errorf("%s: Store is not an ETagStore", loc)
+			continue
+		}
+		testETagStore(t, es)
+		sub, _ := s.MakeSub("sub")
+		testETagStore(t, sub.(ETagStore))
+
+		Create(s, &racingVal{Name: "a", Val: "orig"})
+		vals := map[string]interface{}{"racer": s}
+		if _, err := PatchWith(s, &racingVal{Name: "a"}, []byte(`{"Val":"lost"}`), vals); err == nil {
+			t.Errorf("%s: Expected a patch racing another save to fail", loc)
+		} else if _, ok := err.(PatchConflict); !ok {
+			t.Errorf("%s: Expected PatchConflict, got %v", loc, err)
+		}
+		s.Close()
+	}
+}
+
+// failingLoad is a Store whose Loads fail with err.
+type failingLoad struct {
+	Store
+	err error
+}
+
+func (f *failingLoad) Load(key string, val interface{}) error {
+	return f.err
+}
+
+func TestPatchLoadError(t *testing.T) {
+	s, _ := Open("memory:///")
+	broken := fmt.Errorf("Backend is down")
+	_, err := Patch(&failingLoad{Store: s, err: broken}, &TestVal{Name: "a"}, []byte(`{"Val":"x"}`))
+	if err != broken {
+		t.Errorf("Expected the load error to be returned, got %v", err)
+	}
+	_, err = Patch(&failingLoad{Store: s, err: os.ErrNotExist}, &TestVal{Name: "a"}, []byte(`{"Val":"x"}`))
+	if err == nil || !strings.Contains(err.Error(), "does not already exist") {
+		t.Errorf("Expected a missing object to be reported, got %v", err)
+	}
+}
@@ -0,0 +1,143 @@
+package store
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRawStores(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	// Extra whitespace is kept by raw copies, but not by re-encoding.
+	raw := []byte(`{"Name":  "raw", "Val": "v"}`)
+	for _, loc := range []string{
+		"memory:",
+		"directory:" + path.Join(tmpDir, "dir"),
+		"file:" + path.Join(tmpDir, "data.json"),
+		"bolt:" + path.Join(tmpDir, "bolt"),
+	} {
+		s, err := Open(loc)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", loc, err)
+		}
+		rs, ok := s.(RawStore)
+		if !ok {
+			t.Errorf("%s: Store is not a RawStore", loc)
+			continue
+		}
+		if err := rs.SaveRaw("raw", raw); err != nil {
+			t.Errorf("%s: Failed to save raw value: %v", loc, err)
+		}
+		val := &TestVal{}
+		if err := s.Load("raw", val); err != nil || val.Val != "v" {
+			t.Errorf("%s: Failed to load raw value: %v, %#v", loc, err, val)
+		}
+		if buf, err := rs.LoadRaw("raw"); err != nil || !bytes.Equal(buf, raw) {
+			t.Errorf("%s: Raw value changed: %v, %s", loc, err, string(buf))
+		}
+		if _, err := rs.LoadRaw("missing"); !os.IsNotExist(err) {
+			t.Errorf("%s: Expected loading a missing raw value to fail, got %v", loc, err)
+		}
+
+		dst, _ := Open("memory:")
+		if err := Copy(dst, s); err != nil {
+			t.Errorf("%s: Failed to copy: %v", loc, err)
+		}
+		if buf, _ := dst.(RawStore).LoadRaw("raw"); !bytes.Equal(buf, raw) {
+			t.Errorf("%s: Copy did not copy raw bytes: %s", loc, string(buf))
+		}
+		dst, _ = Open("memory:")
+		if err := Copy(dst, s, Rewrite()); err != nil {
+			t.Errorf("%s: Failed to copy: %v", loc, err)
+		}
+		if buf, _ := dst.(RawStore).LoadRaw("raw"); bytes.Equal(buf, raw) {
+			t.Errorf("%s: Copy with Rewrite did not re-encode", loc)
+		}
+		s.Close()
+	}
+
+	f, _ := Open("file:" + path.Join(tmpDir, "bad.json"))
+	if err := f.(RawStore).SaveRaw("bad", []byte("{not json")); err == nil {
+		t.Errorf("Expected saving undecodable bytes to a file store to fail")
+	}
+	if keys, _ := f.Keys(); len(keys) != 0 {
+		t.Errorf("Failed raw save was not rolled back: %v", keys)
+	}
+	f.Close()
+	func() {
+		defer func() {
+			if recover() != "Operation on closed store" {
+				t.Errorf("Expected saving raw bytes to a closed file store to panic")
+			}
+		}()
+		f.(RawStore).SaveRaw("closed", raw)
+	}()
+
+	stack, _ := Open("stack:")
+	top, _ := Open("memory:")
+	bottom, _ := Open("memory:?codec=yaml")
+	bottom.Save("low", &TestVal{Name: "low"})
+	stack.(*StackedStore).Push(top, false, false)
+	stack.(*StackedStore).Push(bottom, false, false)
+	if buf, err := stack.(RawStore).LoadRaw("low"); err != nil || !bytes.Contains(buf, []byte("Name: low")) {
+		t.Errorf("Stack did not load raw bytes from the lower layer: %v, %s", err, string(buf))
+	}
+	if err := stack.(RawStore).SaveRaw("raw", raw); err != nil {
+		t.Errorf("Failed to save raw value to stack: %v", err)
+	}
+	if buf, _ := top.(RawStore).LoadRaw("raw"); !bytes.Equal(buf, raw) {
+		t.Errorf("Stack did not save raw value to the top layer")
+	}
+	dst, _ := Open("memory:")
+	if err := Copy(dst, stack); err != nil {
+		t.Errorf("Failed to copy stack: %v", err)
+	}
+	if buf, _ := dst.(RawStore).LoadRaw("low"); !bytes.HasPrefix(buf, []byte("{")) {
+		t.Errorf("Values from layers with another codec were not re-encoded: %s", string(buf))
+	}
+
+	wrappedTop, _ := Open("memory:?codec=yaml")
+	stack, _ = Open("stack:")
+	stack.(*StackedStore).Push(Wrap(wrappedTop), false, false)
+	stack.(*StackedStore).Push(Wrap(bottom), false, false)
+	if buf, err := stack.(RawStore).LoadRaw("low"); err != nil || !bytes.Contains(buf, []byte("Name: low")) {
+		t.Errorf("Stack did not load raw bytes from a wrapped layer: %v, %s", err, string(buf))
+	}
+	if err := stack.(RawStore).SaveRaw("wrapped", []byte("Name: wrapped\n")); err != nil {
+		t.Errorf("Failed to save raw value to a wrapped layer: %v", err)
+	}
+	val := &TestVal{}
+	if err := wrappedTop.Load("wrapped", val); err != nil || val.Name != "wrapped" {
+		t.Errorf("Raw value was not saved through the wrapped layer: %v, %v", err, val)
+	}
+}
+
+// testConvertedRaw checks a RawStore whose values are converted to and
+// from JSON on the wire, so the bytes loaded are not those saved.
+func testConvertedRaw(t *testing.T, rs RawStore) {
+	if err := rs.SaveRaw("raw", []byte(`{"Name":  "raw", "Val": "v"}`)); err != nil {
+		t.Errorf("Failed to save raw value: %v", err)
+	}
+	val := &TestVal{}
+	if err := rs.Load("raw", val); err != nil || val.Val != "v" {
+		t.Errorf("Failed to load raw value: %v, %#v", err, val)
+	}
+	val = &TestVal{}
+	if buf, err := rs.LoadRaw("raw"); err != nil {
+		t.Errorf("Failed to load raw value: %v", err)
+	} else if err := rs.GetCodec().Decode(buf, val); err != nil || val.Name != "raw" {
+		t.Errorf("Raw value does not decode: %v, %s", err, string(buf))
+	}
+	if _, err := rs.LoadRaw("missing"); !os.IsNotExist(err) {
+		t.Errorf("Expected loading a missing raw value to fail, got %v", err)
+	}
+	if err := rs.SaveRaw("bad", []byte("{not json")); err == nil {
+		t.Errorf("Expected saving undecodable bytes to fail")
+	}
+}
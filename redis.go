@@ -0,0 +1,388 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis implements a Store that is backed by Redis.  The values in
+// each Store are kept in a single Redis hash named after BaseKey, and
+// substores are kept in hashes named BaseKey/name.  The names of the
+// substores of each Store are kept in the set BaseKey/._subs, and
+// metadata is kept in the hash BaseKey/._meta of the top-level Store.
+//
+// If TTL is set, each value expires once TTL has passed without it
+// being saved, which makes Redis suited to ephemeral state.
+type Redis struct {
+	storeBase
+	Client *redis.Client
+	// Options are used to connect to Redis if Client is nil.
+	Options *redis.Options
+	BaseKey string
+	// TTL is how long each value lives after it was last saved.  As
+	// Redis can only expire whole hashes, the time each value expires
+	// at is kept in the sorted set BaseKey/._expiry, going by the clock
+	// of the Redis server.  Expired values are deleted as the Store is
+	// next read, and the hash and the set themselves expire once
+	// nothing has been saved for TTL.
+	TTL time.Duration
+}
+
+// redisFromURI makes a Redis Store for a redis: locator.
+func redisFromURI(uri *url.URL, path string) (*Redis, error) {
+	params := uri.Query()
+	res := &Redis{BaseKey: path, Options: &redis.Options{Addr: uri.Host}}
+	if uri.User != nil {
+		res.Options.Username = uri.User.Username()
+		res.Options.Password, _ = uri.User.Password()
+	}
+	var err error
+	if db := params.Get("db"); db != "" {
+		if res.Options.DB, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("Invalid db value %s", db)
+		}
+	}
+	if ttl := params.Get("ttl"); ttl != "" {
+		if res.TTL, err = time.ParseDuration(ttl); err != nil {
+			return nil, fmt.Errorf("Invalid ttl value %s", ttl)
+		}
+	}
+	return res, nil
+}
+
+func (r *Redis) Type() string {
+	return "redis"
+}
+
+func (r *Redis) subsKey() string {
+	return r.BaseKey + "/._subs"
+}
+
+func (r *Redis) metaKey() string {
+	return r.BaseKey + "/._meta"
+}
+
+func (r *Redis) expiryKey() string {
+	return r.BaseKey + "/._expiry"
+}
+
+// redisSave saves ARGV[2] as the field ARGV[1] of the hash KEYS[1],
+// and records in the sorted set KEYS[2] that it expires ARGV[3]
+// milliseconds from now.
+var redisSave = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+redis.call('ZADD', KEYS[2], now + tonumber(ARGV[3]), ARGV[1])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+redis.call('PEXPIRE', KEYS[2], ARGV[3])
+return 1
+`)
+
+// redisExpire returns the fields of the hash KEYS[1] that have expired
+// according to the sorted set KEYS[2], and deletes them if ARGV[1] is
+// 1.
+var redisExpire = redis.NewScript(`
+local t = redis.call('TIME')
+local now = t[1] * 1000 + math.floor(t[2] / 1000)
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', now)
+if ARGV[1] == '1' and #expired > 0 then
+	redis.call('HDEL', KEYS[1], unpack(expired))
+	redis.call('ZREM', KEYS[2], unpack(expired))
+end
+return expired
+`)
+
+// expired returns the values of r that have expired but are still in
+// its hash, which can only happen if r is read-only.  Otherwise they
+// are deleted.
+func (r *Redis) expired(ctx context.Context) (map[string]bool, error) {
+	res := map[string]bool{}
+	if r.TTL <= 0 {
+		return res, nil
+	}
+	purge := "1"
+	if r.ReadOnly() {
+		purge = "0"
+	}
+	keys, err := redisExpire.Run(ctx, r.Client, []string{r.BaseKey, r.expiryKey()}, purge).StringSlice()
+	if err != nil || purge == "1" {
+		return res, err
+	}
+	for _, k := range keys {
+		res[k] = true
+	}
+	return res, nil
+}
+
+func (r *Redis) Open(codec Codec) error {
+	r.BaseKey = strings.Trim(r.BaseKey, "/")
+	if r.BaseKey == "" {
+		return fmt.Errorf("Cannot store data at an empty location in Redis!")
+	}
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	r.Codec = codec
+	ctx := context.Background()
+	if r.Client == nil {
+		if r.Options == nil {
+			r.Options = &redis.Options{}
+		}
+		client := redis.NewClient(r.Options)
+		if err := client.Ping(ctx).Err(); err != nil {
+			client.Close()
+			return err
+		}
+		r.Client = client
+		r.closer = func() {
+			r.Client.Close()
+			r.Client = nil
+		}
+	}
+	subs, err := r.Client.SMembers(ctx, r.subsKey()).Result()
+	if err != nil {
+		return err
+	}
+	r.opened = true
+	for _, sub := range subs {
+		if _, err := r.openSub(sub); err != nil {
+			return err
+		}
+	}
+	md := r.MetaData()
+	if n, ok := md["Name"]; ok {
+		r.name = n
+	}
+	return nil
+}
+
+func (r *Redis) MakeSub(prefix string) (Store, error) {
+	r.Lock()
+	defer r.Unlock()
+	r.panicIfClosed()
+	if res, ok := r.subStores[prefix]; ok {
+		return res, nil
+	}
+	if prefix == "" || strings.Contains(prefix, "/") || strings.HasPrefix(prefix, "._") {
+		return nil, fmt.Errorf("Invalid substore name %s", prefix)
+	}
+	if !r.readOnly {
+		if err := r.Client.SAdd(context.Background(), r.subsKey(), prefix).Err(); err != nil {
+			return nil, err
+		}
+	}
+	return r.openSub(prefix)
+}
+
+// openSub opens the existing substore prefix of r.
+func (r *Redis) openSub(prefix string) (Store, error) {
+	res := &Redis{Client: r.Client, BaseKey: r.BaseKey + "/" + prefix, TTL: r.TTL}
+	if err := res.Open(r.Codec); err != nil {
+		return nil, err
+	}
+	addSub(r, res, prefix)
+	return res, nil
+}
+
+func (r *Redis) Keys() ([]string, error) {
+	r.panicIfClosed()
+	ctx := context.Background()
+	expired, err := r.expired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := r.Client.HKeys(ctx, r.BaseKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	res := []string{}
+	for _, k := range keys {
+		if !expired[k] {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+func (r *Redis) LoadRaw(key string) ([]byte, error) {
+	r.panicIfClosed()
+	ctx := context.Background()
+	expired, err := r.expired(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if expired[key] {
+		return nil, os.ErrNotExist
+	}
+	res, err := r.Client.HGet(ctx, r.BaseKey, key).Bytes()
+	if err == redis.Nil {
+		return nil, os.ErrNotExist
+	}
+	return res, err
+}
+
+func (r *Redis) Load(key string, val interface{}) error {
+	buf, err := r.LoadRaw(key)
+	if err != nil {
+		return err
+	}
+	if err := r.Decode(buf, val); err != nil {
+		return decodeError(r.BaseKey, key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(r.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := r.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return nil
+}
+
+func (r *Redis) SaveRaw(key string, buf []byte) error {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx := context.Background()
+	if r.TTL > 0 {
+		keys := []string{r.BaseKey, r.expiryKey()}
+		return redisSave.Run(ctx, r.Client, keys, key, buf, r.TTL.Milliseconds()).Err()
+	}
+	return r.Client.HSet(ctx, r.BaseKey, key, buf).Err()
+}
+
+func (r *Redis) Save(key string, val interface{}) error {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := r.Encode(val)
+	if err != nil {
+		return err
+	}
+	return r.SaveRaw(key, buf)
+}
+
+// SaveStream reads all of rd into memory and saves it as key.
+func (r *Redis) SaveStream(key string, rd io.Reader) error {
+	buf, err := ioutil.ReadAll(rd)
+	if err != nil {
+		return err
+	}
+	return r.SaveRaw(key, buf)
+}
+
+func (r *Redis) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := r.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (r *Redis) Remove(key string) error {
+	r.panicIfClosed()
+	if r.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx := context.Background()
+	if r.TTL <= 0 {
+		n, err := r.Client.HDel(ctx, r.BaseKey, key).Result()
+		if err == nil && n == 0 {
+			err = os.ErrNotExist
+		}
+		return err
+	}
+	// Expired values are purged first, so that they count as missing.
+	if _, err := r.expired(ctx); err != nil {
+		return err
+	}
+	var hdel *redis.IntCmd
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		hdel = pipe.HDel(ctx, r.BaseKey, key)
+		pipe.ZRem(ctx, r.expiryKey(), key)
+		return nil
+	})
+	if err == nil && hdel.Val() == 0 {
+		err = os.ErrNotExist
+	}
+	return err
+}
+
+// Watch calls fn whenever the hash holding r changes, by way of Redis
+// keyspace notifications.  They must be enabled on the server with
+// notify-keyspace-events including at least K, h, g, and x.  The
+// notifications do not say which field of the hash changed, so every
+// Event has an empty Key.
+func (r *Redis) Watch(fn func(Event)) (func(), error) {
+	r.panicIfClosed()
+	ctx := context.Background()
+	channel := fmt.Sprintf("__keyspace@%d__:%s", r.Client.Options().DB, r.BaseKey)
+	sub := r.Client.Subscribe(ctx, channel)
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+	go func() {
+		for msg := range sub.Channel() {
+			switch msg.Payload {
+			case "hset", "hsetnx", "hincrby", "hincrbyfloat":
+				fn(Event{Op: OpSave})
+			case "hdel", "del", "expired", "evicted", "rename_from":
+				fn(Event{Op: OpRemove})
+			default:
+				fn(Event{})
+			}
+		}
+	}()
+	return func() { sub.Close() }, nil
+}
+
+func (r *Redis) MetaData() map[string]string {
+	if r.parentStore != nil {
+		return r.parentStore.(*Redis).MetaData()
+	}
+	res, err := r.Client.HGetAll(context.Background(), r.metaKey()).Result()
+	if err != nil {
+		return map[string]string{}
+	}
+	return res
+}
+
+func (r *Redis) SetMetaData(vals map[string]string) error {
+	if r.parentStore != nil {
+		return r.parentStore.(*Redis).SetMetaData(vals)
+	}
+	if r.ReadOnly() {
+		return UnWritable("metadata")
+	}
+	ctx := context.Background()
+	_, err := r.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, r.metaKey())
+		if len(vals) > 0 {
+			pipe.HSet(ctx, r.metaKey(), vals)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n, ok := vals["Name"]; ok {
+		r.name = n
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStore(t *testing.T) {
+	mr := miniredis.RunT(t)
+	loc := "redis://" + mr.Addr() + "/digitalrebar"
+	s, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open redis store: %v", err)
+	}
+	// testStore leaves s read-only, so metadata is set first.
+	if err := s.(MetaSaver).SetMetaData(map[string]string{"Name": "redis"}); err != nil {
+		t.Errorf("Failed to set metadata: %v", err)
+	}
+	kept, err := s.MakeSub("kept")
+	if err != nil {
+		t.Fatalf("Failed to make substore: %v", err)
+	}
+	if _, err := kept.MakeSub("nested"); err != nil {
+		t.Fatalf("Failed to make substore: %v", err)
+	}
+	testStore(t, s)
+	s.Close()
+
+	ro, err := Open(loc + "?ro=true")
+	if err != nil {
+		t.Fatalf("Failed to open read-only redis store: %v", err)
+	}
+	if _, err := ro.MakeSub("rosub"); err != nil {
+		t.Errorf("Failed to make substore of a read-only store: %v", err)
+	}
+	if ok, _ := mr.SIsMember("digitalrebar/._subs", "rosub"); ok {
+		t.Errorf("Expected making a substore of a read-only store not to write to it")
+	}
+	if err := ro.(MetaSaver).SetMetaData(map[string]string{"Name": "ro"}); err != UnWritable("metadata") {
+		t.Errorf("Expected setting metadata on a read-only store to fail, got %v", err)
+	}
+	ro.Close()
+
+	s, err = Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to reopen redis store: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "redis" {
+		t.Errorf("Metadata did not persist")
+	}
+	if s.GetSub("kept") == nil || s.GetSub("kept").GetSub("nested") == nil {
+		t.Errorf("Substores did not persist")
+	}
+	// testStore makes its substores once s is read-only.
+	if s.GetSub("sub1") != nil {
+		t.Errorf("Expected a substore made by a read-only store not to persist")
+	}
+
+	events := make(chan Event, 10)
+	cancel, err := s.(*Redis).Watch(func(ev Event) { events <- ev })
+	if err != nil {
+		t.Fatalf("Failed to watch: %v", err)
+	}
+	defer cancel()
+	// miniredis does not send keyspace notifications, so send one the
+	// way Redis would.
+	mr.Publish("__keyspace@0__:digitalrebar", "hdel")
+	select {
+	case ev := <-events:
+		if ev.Op != OpRemove || ev.Key != "" {
+			t.Errorf("Unexpected watch event %#v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Timed out waiting for watch event")
+	}
+
+	now := time.Now()
+	mr.SetTime(now)
+	advance := func(d time.Duration) {
+		now = now.Add(d)
+		mr.SetTime(now)
+		mr.FastForward(d)
+	}
+	eph, err := Open("redis://" + mr.Addr() + "/ephemeral?ttl=1m")
+	if err != nil {
+		t.Fatalf("Failed to open redis store with a TTL: %v", err)
+	}
+	defer eph.Close()
+	if err := eph.Save("lease", &TestVal{Name: "lease"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	advance(30 * time.Second)
+	if err := eph.Save("other", &TestVal{Name: "other"}); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	advance(45 * time.Second)
+	ro, err = Open("redis://" + mr.Addr() + "/ephemeral?ttl=1m&ro=true")
+	if err != nil {
+		t.Fatalf("Failed to open read-only redis store: %v", err)
+	}
+	defer ro.Close()
+	if !ro.ReadOnly() {
+		t.Fatalf("Expected the store to be read-only")
+	}
+	if keys, _ := ro.Keys(); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("Expected expired values to be hidden from a read-only store, got keys %v", keys)
+	}
+	if err := ro.Load("lease", &TestVal{}); !os.IsNotExist(err) {
+		t.Errorf("Expected an expired value to be missing, got %v", err)
+	}
+	if keys, _ := eph.Keys(); len(keys) != 1 || keys[0] != "other" {
+		t.Errorf("Expected only the value saved last to be left, got keys %v", keys)
+	}
+	if n, _ := mr.HKeys("ephemeral"); len(n) != 1 {
+		t.Errorf("Expected the expired value to be deleted, hash holds %v", n)
+	}
+	if err := eph.Remove("lease"); !os.IsNotExist(err) {
+		t.Errorf("Expected removing an expired value to fail, got %v", err)
+	}
+	advance(time.Minute)
+	if keys, _ := eph.Keys(); len(keys) != 0 {
+		t.Errorf("Expected values to expire, got keys %v", keys)
+	}
+}
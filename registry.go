@@ -0,0 +1,111 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// Interceptor is a function that runs around a KeySaver operation
+// (Create, Update, Patch, Save, Remove, Load, or each object loaded
+// by List).  It is passed the HookContext for the operation and the
+// object being operated on, and it must call next for the operation
+// to proceed.
+//
+// An Interceptor can veto the operation by returning an error without
+// calling next, mutate the object before or after calling next, or
+// pass a different KeySaver to next to have the operation work on it
+// instead.  Interceptors run before any of the object's own hooks.
+type Interceptor func(ctx *HookContext, k KeySaver, next func(KeySaver) error) error
+
+type interceptor struct {
+	prefix string
+	ops    []Op
+	order  int
+	seq    int
+	fn     Interceptor
+}
+
+func (i *interceptor) matches(op Op, prefix string) bool {
+	if i.prefix != "" && i.prefix != prefix {
+		return false
+	}
+	if len(i.ops) == 0 {
+		return true
+	}
+	for _, o := range i.ops {
+		if o == op ||
+			(o == OpLoad && op == OpList) ||
+			(o == OpUpdate && op == OpPatch) {
+			return true
+		}
+	}
+	return false
+}
+
+var registry = struct {
+	sync.RWMutex
+	entries []*interceptor
+	seq     int
+}{}
+
+// RegisterInterceptor adds fn to the set of Interceptors that run
+// around KeySaver operations.  If prefix is not empty, fn only runs for
+// objects whose Prefix() matches.  If ops are passed, fn only runs
+// for those operations; an Interceptor for OpLoad also runs for each
+// object loaded by List, and one for OpUpdate also runs for Patch.
+//
+// Interceptors run in ascending order, with Interceptors of the same
+// order running in the order they were registered.  The first
+// Interceptor to run is the outermost one.  The returned function
+// removes fn from the registry.
+func RegisterInterceptor(prefix string, order int, fn Interceptor, ops ...Op) func() {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.seq++
+	ent := &interceptor{
+		prefix: prefix,
+		ops:    ops,
+		order:  order,
+		seq:    registry.seq,
+		fn:     fn,
+	}
+	registry.entries = append(registry.entries, ent)
+	sort.Slice(registry.entries, func(i, j int) bool {
+		a, b := registry.entries[i], registry.entries[j]
+		if a.order != b.order {
+			return a.order < b.order
+		}
+		return a.seq < b.seq
+	})
+	return func() {
+		registry.Lock()
+		defer registry.Unlock()
+		for i := range registry.entries {
+			if registry.entries[i] == ent {
+				registry.entries = append(registry.entries[:i], registry.entries[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func intercept(ctx *HookContext, k KeySaver, final func(KeySaver) error) error {
+	registry.RLock()
+	chain := []Interceptor{}
+	for _, ent := range registry.entries {
+		if ent.matches(ctx.Op, k.Prefix()) {
+			chain = append(chain, ent.fn)
+		}
+	}
+	registry.RUnlock()
+	var call func(int, KeySaver) error
+	call = func(i int, k KeySaver) error {
+		if i == len(chain) {
+			return final(k)
+		}
+		return chain[i](ctx, k, func(next KeySaver) error {
+			return call(i+1, next)
+		})
+	}
+	return call(0, k)
+}
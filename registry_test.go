@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestInterceptors(t *testing.T) {
+	s, _ := Open("memory:///")
+	order := []string{}
+	vetoed := errors.New("vetoed")
+	unregs := []func(){
+		RegisterInterceptor("", 10, func(ctx *HookContext, k KeySaver, next func(KeySaver) error) error {
+			order = append(order, "outer:"+string(ctx.Op))
+			return next(k)
+		}),
+		RegisterInterceptor("testVal", 20, func(ctx *HookContext, k KeySaver, next func(KeySaver) error) error {
+			order = append(order, "inner:"+string(ctx.Op))
+			k.(*TestVal).Val = "stamped"
+			return next(k)
+		}, OpCreate, OpUpdate),
+		RegisterInterceptor("testVal", 0, func(ctx *HookContext, k KeySaver, next func(KeySaver) error) error {
+			return vetoed
+		}, OpRemove),
+		RegisterInterceptor("otherPrefix", 0, func(ctx *HookContext, k KeySaver, next func(KeySaver) error) error {
+			t.Errorf("Interceptor for otherPrefix ran for %s", k.Prefix())
+			return next(k)
+		}),
+	}
+	defer func() {
+		for _, unreg := range unregs {
+			unreg()
+		}
+	}()
+	obj := &TestVal{Name: "intercepted", Val: "orig"}
+	if ok, err := Create(s, obj); !ok {
+		t.Fatalf("Create failed: %v", err)
+	}
+	loaded := &TestVal{Name: "intercepted"}
+	if ok, err := Load(s, loaded); !ok {
+		t.Fatalf("Load failed: %v", err)
+	} else if loaded.Val != "stamped" {
+		t.Errorf("Expected interceptor to mutate the object, got Val %q", loaded.Val)
+	}
+	if _, err := Patch(s, loaded, []byte(`{"Val":"patched"}`)); err != nil {
+		t.Errorf("Patch failed: %v", err)
+	}
+	if ok, err := Remove(s, loaded); ok || err != vetoed {
+		t.Errorf("Expected remove to be vetoed, got %v, %v", ok, err)
+	}
+	expected := []string{
+		"outer:create", "inner:create",
+		"outer:load",
+		"outer:patch", "inner:patch",
+	}
+	if len(order) != len(expected) {
+		t.Fatalf("Expected interceptors %v, got %v", expected, order)
+	}
+	for i := range expected {
+		if order[i] != expected[i] {
+			t.Errorf("Expected interceptors %v, got %v", expected, order)
+			break
+		}
+	}
+}
@@ -0,0 +1,388 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3 implements a Store that is backed by an S3-compatible object
+// store.  Each value is the object Prefix/key.ext, where key is query
+// escaped and ext is the extension of the Codec, and substores are
+// kept under Prefix/name/, which is marked by an empty object.
+// Metadata is kept as JSON in the object Prefix/._meta of the
+// top-level Store.  Values are named like the files of a Directory
+// store, but metadata and substores are not, so use Copy rather than
+// copying files to move a Directory to S3.
+type S3 struct {
+	storeBase
+	Client *minio.Client
+	// Options are used to connect to Endpoint if Client is nil.
+	Options  *minio.Options
+	Endpoint string
+	Bucket   string
+	Prefix   string
+	// PageSize is how many objects Keys asks for at a time.  S3 and
+	// most compatible servers return at most 1000.
+	PageSize int
+}
+
+const s3MetaObject = "._meta"
+
+// s3FromURI makes an S3 Store for an s3: locator.
+func s3FromURI(uri *url.URL, path string) (*S3, error) {
+	params := uri.Query()
+	res := &S3{
+		Bucket:   uri.Host,
+		Prefix:   path,
+		Endpoint: params.Get("endpoint"),
+		Options:  &minio.Options{Secure: true, Region: params.Get("region")},
+	}
+	if res.Endpoint == "" {
+		res.Endpoint = "s3.amazonaws.com"
+	}
+	if secure := params.Get("secure"); secure != "" {
+		var err error
+		if res.Options.Secure, err = strconv.ParseBool(secure); err != nil {
+			return nil, fmt.Errorf("Invalid secure value %s", secure)
+		}
+	}
+	if uri.User != nil {
+		secret, _ := uri.User.Password()
+		res.Options.Creds = credentials.NewStaticV4(uri.User.Username(), secret, "")
+	} else {
+		res.Options.Creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.EnvMinio{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{},
+		})
+	}
+	return res, nil
+}
+
+func (s *S3) Type() string {
+	return "s3"
+}
+
+func (s *S3) prefix() string {
+	if s.Prefix == "" {
+		return ""
+	}
+	return s.Prefix + "/"
+}
+
+func (s *S3) objectName(key string) string {
+	return s.prefix() + url.QueryEscape(key) + s.Ext()
+}
+
+func s3NotFound(err error) bool {
+	code := minio.ToErrorResponse(err).Code
+	return code == "NoSuchKey" || code == "NotFound"
+}
+
+func (s *S3) Open(codec Codec) error {
+	s.Prefix = strings.Trim(s.Prefix, "/")
+	if s.Bucket == "" {
+		return fmt.Errorf("Cannot store data without a bucket")
+	}
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	s.Codec = codec
+	if s.PageSize == 0 {
+		s.PageSize = 1000
+	}
+	ctx := context.Background()
+	if s.Client == nil {
+		if s.Options == nil {
+			s.Options = &minio.Options{Secure: true}
+		}
+		client, err := minio.New(s.Endpoint, s.Options)
+		if err != nil {
+			return err
+		}
+		if ok, err := client.BucketExists(ctx, s.Bucket); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("Bucket %s does not exist", s.Bucket)
+		}
+		s.Client = client
+		s.closer = func() {
+			s.Client = nil
+		}
+	}
+	s.opened = true
+	subs := []string{}
+	for obj := range s.list(false) {
+		if obj.Err != nil {
+			return obj.Err
+		}
+		if name := strings.TrimPrefix(obj.Key, s.prefix()); strings.HasSuffix(name, "/") {
+			subs = append(subs, strings.TrimSuffix(name, "/"))
+		}
+	}
+	for _, sub := range subs {
+		if _, err := s.openSub(sub); err != nil {
+			return err
+		}
+	}
+	md := s.MetaData()
+	if n, ok := md["Name"]; ok {
+		s.name = n
+	}
+	return nil
+}
+
+// list lists the objects directly under the prefix of s, fetching
+// them PageSize at a time.  Substores are listed as common prefixes
+// ending in /.
+func (s *S3) list(recursive bool) <-chan minio.ObjectInfo {
+	return s.Client.ListObjects(context.Background(), s.Bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix(),
+		Recursive: recursive,
+		MaxKeys:   s.PageSize,
+	})
+}
+
+func (s *S3) MakeSub(prefix string) (Store, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.panicIfClosed()
+	if res, ok := s.subStores[prefix]; ok {
+		return res, nil
+	}
+	if prefix == "" || strings.Contains(prefix, "/") || strings.HasPrefix(prefix, "._") {
+		return nil, fmt.Errorf("Invalid substore name %s", prefix)
+	}
+	if !s.readOnly {
+		// A streaming signature would make the empty marker be sent
+		// chunked, which S3 rejects for lack of a Content-Length.
+		_, err := s.Client.PutObject(context.Background(), s.Bucket, s.prefix()+prefix+"/",
+			bytes.NewReader(nil), 0, minio.PutObjectOptions{DisableContentSha256: true})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return s.openSub(prefix)
+}
+
+// openSub opens the existing substore prefix of s.
+func (s *S3) openSub(prefix string) (Store, error) {
+	res := &S3{Client: s.Client, Bucket: s.Bucket, Prefix: s.prefix() + prefix, PageSize: s.PageSize}
+	if err := res.Open(s.Codec); err != nil {
+		return nil, err
+	}
+	addSub(s, res, prefix)
+	return res, nil
+}
+
+func (s *S3) Keys() ([]string, error) {
+	s.panicIfClosed()
+	res := []string{}
+	for obj := range s.list(false) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		name := strings.TrimPrefix(obj.Key, s.prefix())
+		if !strings.HasSuffix(name, s.Ext()) || strings.HasPrefix(name, "._") {
+			continue
+		}
+		key, err := url.QueryUnescape(strings.TrimSuffix(name, s.Ext()))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, nil
+}
+
+// loadRaw returns the raw value of key and its ETag.
+func (s *S3) loadRaw(key string) ([]byte, string, error) {
+	s.panicIfClosed()
+	obj, err := s.Client.GetObject(context.Background(), s.Bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, "", err
+	}
+	defer obj.Close()
+	info, err := obj.Stat()
+	if err != nil {
+		if s3NotFound(err) {
+			return nil, "", os.ErrNotExist
+		}
+		return nil, "", err
+	}
+	buf, err := ioutil.ReadAll(obj)
+	return buf, info.ETag, err
+}
+
+func (s *S3) LoadRaw(key string) ([]byte, error) {
+	buf, _, err := s.loadRaw(key)
+	return buf, err
+}
+
+func (s *S3) Load(key string, val interface{}) error {
+	_, err := s.LoadETag(key, val)
+	return err
+}
+
+// LoadETag is Load, and also returns the ETag of key for use with
+// SaveETag.
+func (s *S3) LoadETag(key string, val interface{}) (string, error) {
+	buf, etag, err := s.loadRaw(key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Decode(buf, val); err != nil {
+		return "", decodeError(s.Bucket+"/"+s.objectName(key), key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(s.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := s.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return etag, nil
+}
+
+func (s *S3) put(key string, r io.Reader, size int64, opts minio.PutObjectOptions) (string, error) {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	info, err := s.Client.PutObject(context.Background(), s.Bucket, s.objectName(key), r, size, opts)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			return "", StaleRevision(key)
+		}
+		return "", err
+	}
+	return info.ETag, nil
+}
+
+func (s *S3) SaveRaw(key string, buf []byte) error {
+	_, err := s.put(key, bytes.NewReader(buf), int64(len(buf)), minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3) Save(key string, val interface{}) error {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := s.Encode(val)
+	if err != nil {
+		return err
+	}
+	return s.SaveRaw(key, buf)
+}
+
+// SaveETag saves val as key only if the ETag of key is still etag,
+// which is usually the ETag returned by LoadETag.  An empty etag means
+// that key must not exist yet.  It returns the new ETag of key, or
+// StaleRevision if key was changed in the meantime.  The server must
+// support conditional writes.
+func (s *S3) SaveETag(key string, val interface{}, etag string) (string, error) {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	buf, err := s.Encode(val)
+	if err != nil {
+		return "", err
+	}
+	opts := minio.PutObjectOptions{}
+	if etag == "" {
+		opts.SetMatchETagExcept("*")
+	} else {
+		opts.SetMatchETag(etag)
+	}
+	return s.put(key, bytes.NewReader(buf), int64(len(buf)), opts)
+}
+
+// SaveStream uploads r as key without reading all of it into memory.
+func (s *S3) SaveStream(key string, r io.Reader) error {
+	_, err := s.put(key, r, -1, minio.PutObjectOptions{})
+	return err
+}
+
+func (s *S3) LoadStream(key string) (io.ReadCloser, error) {
+	s.panicIfClosed()
+	obj, err := s.Client.GetObject(context.Background(), s.Bucket, s.objectName(key), minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if s3NotFound(err) {
+			return nil, os.ErrNotExist
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *S3) Remove(key string) error {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return UnWritable(key)
+	}
+	ctx := context.Background()
+	name := s.objectName(key)
+	if _, err := s.Client.StatObject(ctx, s.Bucket, name, minio.StatObjectOptions{}); err != nil {
+		if s3NotFound(err) {
+			return os.ErrNotExist
+		}
+		return err
+	}
+	return s.Client.RemoveObject(ctx, s.Bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (s *S3) MetaData() map[string]string {
+	if s.parentStore != nil {
+		return s.parentStore.(*S3).MetaData()
+	}
+	res := map[string]string{}
+	obj, err := s.Client.GetObject(context.Background(), s.Bucket, s.prefix()+s3MetaObject, minio.GetObjectOptions{})
+	if err != nil {
+		return res
+	}
+	defer obj.Close()
+	json.NewDecoder(obj).Decode(&res)
+	return res
+}
+
+func (s *S3) SetMetaData(vals map[string]string) error {
+	if s.parentStore != nil {
+		return s.parentStore.(*S3).SetMetaData(vals)
+	}
+	if s.ReadOnly() {
+		return UnWritable("metadata")
+	}
+	buf, err := json.Marshal(vals)
+	if err != nil {
+		return err
+	}
+	_, err = s.Client.PutObject(context.Background(), s.Bucket, s.prefix()+s3MetaObject,
+		bytes.NewReader(buf), int64(len(buf)), minio.PutObjectOptions{ContentType: "application/json"})
+	if err != nil {
+		return err
+	}
+	if n, ok := vals["Name"]; ok {
+		s.name = n
+	}
+	return nil
+}
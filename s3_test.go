@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// conditionalPuts adds support for If-Match and If-None-Match on PUT
+// to a fake S3 server that lacks it.
+func conditionalPuts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifMatch, ifNoneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if r.Method != http.MethodPut || (ifMatch == "" && ifNoneMatch == "") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		head := httptest.NewRecorder()
+		next.ServeHTTP(head, httptest.NewRequest(http.MethodHead, r.URL.String(), nil))
+		etag := head.Header().Get("ETag")
+		exists := head.Code == http.StatusOK
+		if (ifMatch != "" && (!exists || etag != ifMatch)) || (ifNoneMatch == "*" && exists) {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusPreconditionFailed)
+			fmt.Fprint(w, `<?xml version="1.0" encoding="UTF-8"?>`+
+				`<Error><Code>PreconditionFailed</Code><Message>At least one of the preconditions you specified did not hold</Message></Error>`)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func TestS3Store(t *testing.T) {
+	faker := gofakes3.New(s3mem.New())
+	handler, puts := conditionalPuts(faker.Server()), int32(0)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodPut {
+			atomic.AddInt32(&puts, 1)
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	endpoint := strings.TrimPrefix(srv.URL, "http://")
+	client, err := minio.New(endpoint, &minio.Options{Creds: credentials.NewStaticV4("key", "secret", "")})
+	if err != nil {
+		t.Fatalf("Failed to make client: %v", err)
+	}
+	if err := client.MakeBucket(context.Background(), "rebar", minio.MakeBucketOptions{}); err != nil {
+		t.Fatalf("Failed to make bucket: %v", err)
+	}
+
+	loc := "s3://key:secret@rebar/digitalrebar?secure=false&endpoint=" + endpoint
+	s, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open s3 store: %v", err)
+	}
+	if err := s.(MetaSaver).SetMetaData(map[string]string{"Name": "s3"}); err != nil {
+		t.Errorf("Failed to set metadata: %v", err)
+	}
+	testStore(t, s)
+	s.Close()
+
+	s, err = Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to reopen s3 store: %v", err)
+	}
+	defer s.Close()
+	if s.Name() != "s3" {
+		t.Errorf("Metadata did not persist")
+	}
+	if s.GetSub("sub1") == nil || s.GetSub("sub1").GetSub("sub2") == nil {
+		t.Errorf("Substores did not persist")
+	}
+
+	s3 := s.(*S3)
+	testETagStore(t, s3)
+
+	atomic.StoreInt32(&puts, 0)
+	ro, err := Open(loc + "&ro=true")
+	if err != nil {
+		t.Fatalf("Failed to open read-only s3 store: %v", err)
+	}
+	if n := atomic.LoadInt32(&puts); n != 0 {
+		t.Errorf("Expected opening a store not to write to it, made %d PUTs", n)
+	}
+	if err := ro.(MetaSaver).SetMetaData(map[string]string{"Name": "ro"}); err != UnWritable("metadata") {
+		t.Errorf("Expected setting metadata on a read-only store to fail, got %v", err)
+	}
+	ro.Close()
+
+	paged, err := s3.MakeSub("paged")
+	if err != nil {
+		t.Fatalf("Failed to make substore: %v", err)
+	}
+	paged.(*S3).PageSize = 2
+	for i := 0; i < 7; i++ {
+		if err := paged.Save(fmt.Sprintf("key%d", i), &TestVal{Name: "paged"}); err != nil {
+			t.Fatalf("Failed to save: %v", err)
+		}
+	}
+	if keys, err := paged.Keys(); err != nil || len(keys) != 7 {
+		t.Errorf("Expected 7 keys across pages, got %v, %v", keys, err)
+	}
+}
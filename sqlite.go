@@ -0,0 +1,469 @@
+package store
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlQuerier is implemented by both *sql.DB and *sql.Tx.
+type sqlQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS store_values (
+	prefix TEXT NOT NULL,
+	key    TEXT NOT NULL,
+	value  BLOB NOT NULL,
+	PRIMARY KEY (prefix, key)
+);
+CREATE TABLE IF NOT EXISTS store_subs (prefix TEXT NOT NULL PRIMARY KEY);
+CREATE TABLE IF NOT EXISTS store_meta (name TEXT NOT NULL PRIMARY KEY, value TEXT NOT NULL);
+`
+
+// Sqlite implements a Store that is backed by a single SQLite database
+// file, which can safely be shared by several processes.  Substores
+// are kept in the same tables as their parents, with their keys under
+// a hierarchical prefix, and metadata is shared by all of them like it
+// is for Bolt.
+//
+// Values encoded as valid UTF-8 are stored as SQL text, so values
+// saved with a JSON Codec can be searched with Query.
+type Sqlite struct {
+	storeBase
+	Path   string
+	Prefix string
+	db     *sql.DB
+	q      sqlQuerier
+}
+
+func (s *Sqlite) Type() string {
+	return "sqlite"
+}
+
+func (s *Sqlite) MetaData() map[string]string {
+	res := map[string]string{}
+	rows, err := s.q.Query(`SELECT name, value FROM store_meta`)
+	if err != nil {
+		return res
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k, v string
+		if rows.Scan(&k, &v) == nil {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+func (s *Sqlite) SetMetaData(vals map[string]string) error {
+	err := s.inTx(func(q sqlQuerier) error {
+		if _, err := q.Exec(`DELETE FROM store_meta`); err != nil {
+			return err
+		}
+		for k, v := range vals {
+			if _, err := q.Exec(`INSERT INTO store_meta (name, value) VALUES (?, ?)`, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if n, ok := vals["Name"]; ok {
+		s.name = n
+	}
+	return nil
+}
+
+// inTx runs fn in a transaction, unless s is already part of one.
+func (s *Sqlite) inTx(fn func(sqlQuerier) error) error {
+	if s.q != sqlQuerier(s.db) {
+		return fn(s.q)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *Sqlite) subPrefix(loc string) string {
+	if s.Prefix == "" {
+		return loc
+	}
+	return s.Prefix + "/" + loc
+}
+
+func (s *Sqlite) MakeSub(loc string) (Store, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.panicIfClosed()
+	if res, ok := s.subStores[loc]; ok {
+		return res, nil
+	}
+	if strings.Contains(loc, "/") {
+		return nil, fmt.Errorf("Invalid substore name %s", loc)
+	}
+	prefix := s.subPrefix(loc)
+	if _, err := s.q.Exec(`INSERT OR IGNORE INTO store_subs (prefix) VALUES (?)`, prefix); err != nil {
+		return nil, err
+	}
+	res := &Sqlite{Path: s.Path, Prefix: prefix, db: s.db, q: s.q}
+	if err := res.Open(s.Codec); err != nil {
+		return nil, err
+	}
+	res.closer = func() {
+		res.db = nil
+		res.q = nil
+	}
+	addSub(s, res, loc)
+	return res, nil
+}
+
+func (s *Sqlite) loadSubs() error {
+	rows, err := s.q.Query(`SELECT prefix FROM store_subs`)
+	if err != nil {
+		return err
+	}
+	subs := []string{}
+	for rows.Next() {
+		var prefix string
+		if err := rows.Scan(&prefix); err != nil {
+			rows.Close()
+			return err
+		}
+		var loc string
+		if s.Prefix == "" {
+			loc = prefix
+		} else if strings.HasPrefix(prefix, s.Prefix+"/") {
+			loc = strings.TrimPrefix(prefix, s.Prefix+"/")
+		} else {
+			continue
+		}
+		if loc != "" && !strings.Contains(loc, "/") {
+			subs = append(subs, loc)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, sub := range subs {
+		if _, err := s.MakeSub(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sqlite) Open(codec Codec) error {
+	if codec == nil {
+		codec = DefaultCodec
+	}
+	s.Codec = codec
+	if s.db == nil {
+		if s.Path == "" {
+			return fmt.Errorf("Cannot store data in ''")
+		}
+		finalLoc := filepath.Clean(s.Path)
+		if err := os.MkdirAll(filepath.Dir(finalLoc), 0755); err != nil {
+			return err
+		}
+		// WAL and a busy timeout let other processes use the database
+		// at the same time, and immediate transactions keep them from
+		// deadlocking when upgrading to a write lock.
+		dsn := "file:" + finalLoc + "?_busy_timeout=5000&_journal_mode=WAL&_txlock=immediate"
+		db, err := sql.Open("sqlite3", dsn)
+		if err != nil {
+			return err
+		}
+		if _, err := db.Exec(sqliteSchema); err != nil {
+			db.Close()
+			return err
+		}
+		s.db = db
+		s.q = db
+		s.closer = func() {
+			s.db.Close()
+			s.db = nil
+			s.q = nil
+		}
+	}
+	s.opened = true
+	if err := s.loadSubs(); err != nil {
+		return err
+	}
+	md := s.MetaData()
+	if n, ok := md["Name"]; ok {
+		s.name = n
+	}
+	return nil
+}
+
+// Transaction runs fn with a copy of s whose reads and writes, along
+// with those of any substores it makes, all happen in a single
+// transaction.  The transaction is committed if fn returns nil, and
+// rolled back otherwise.  The copy must not be used once fn returns.
+func (s *Sqlite) Transaction(fn func(*Sqlite) error) error {
+	s.panicIfClosed()
+	if s.q != sqlQuerier(s.db) {
+		return fn(s)
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	txs := s.txCopy(tx)
+	if err := fn(txs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	return s.adoptSubs(txs)
+}
+
+// txCopy returns a copy of s and its substores that use tx.
+func (s *Sqlite) txCopy(tx *sql.Tx) *Sqlite {
+	res := &Sqlite{Path: s.Path, Prefix: s.Prefix, db: s.db, q: tx}
+	res.Codec = s.Codec
+	res.name = s.name
+	res.readOnly = s.ReadOnly()
+	res.opened = true
+	for name, sub := range s.Subs() {
+		addSub(res, sub.(*Sqlite).txCopy(tx), name)
+	}
+	return res
+}
+
+// adoptSubs opens the substores made in txs, a copy of s made for a
+// Transaction, which exist now that it is committed.
+func (s *Sqlite) adoptSubs(txs *Sqlite) error {
+	for name, txSub := range txs.Subs() {
+		sub, err := s.MakeSub(name)
+		if err != nil {
+			return err
+		}
+		if err := sub.(*Sqlite).adoptSubs(txSub.(*Sqlite)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sqlite) keys(query string, args ...interface{}) ([]string, error) {
+	s.panicIfClosed()
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		res = append(res, key)
+	}
+	return res, rows.Err()
+}
+
+func (s *Sqlite) Keys() ([]string, error) {
+	return s.keys(`SELECT key FROM store_values WHERE prefix = ? ORDER BY key`, s.Prefix)
+}
+
+// KeysWithPrefix returns the keys in s that start with prefix, in
+// sorted order.
+func (s *Sqlite) KeysWithPrefix(prefix string) ([]string, error) {
+	end, ok := prefixEnd(prefix)
+	if !ok {
+		return s.keys(`SELECT key FROM store_values WHERE prefix = ? AND key >= ? ORDER BY key`,
+			s.Prefix, prefix)
+	}
+	return s.keys(`SELECT key FROM store_values WHERE prefix = ? AND key >= ? AND key < ? ORDER BY key`,
+		s.Prefix, prefix, end)
+}
+
+// prefixEnd returns the least string greater than every string that
+// starts with prefix, comparing bytes as SQLite does, or false if
+// there is none.
+func prefixEnd(prefix string) (string, bool) {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1]), true
+		}
+	}
+	return "", false
+}
+
+// Query returns the keys of the values in s whose field is equal to
+// val, in sorted order.  field is a path into the value such as Name
+// or Params.os, and only values stored as JSON text are searched.  As
+// SQLite has no boolean type, JSON true and false are equal to 1 and 0.
+func (s *Sqlite) Query(field string, val interface{}) ([]string, error) {
+	if b, ok := val.(bool); ok {
+		val = 0
+		if b {
+			val = 1
+		}
+	}
+	return s.keys(`SELECT key FROM store_values WHERE prefix = ? AND
+	CASE WHEN typeof(value) = 'text' AND json_valid(value) THEN json_extract(value, ?) END = ?
+	ORDER BY key`, s.Prefix, "$."+field, val)
+}
+
+func (s *Sqlite) LoadRaw(key string) ([]byte, error) {
+	s.panicIfClosed()
+	var res []byte
+	err := s.q.QueryRow(`SELECT value FROM store_values WHERE prefix = ? AND key = ?`, s.Prefix, key).Scan(&res)
+	if err == sql.ErrNoRows {
+		return nil, os.ErrNotExist
+	}
+	return res, err
+}
+
+func (s *Sqlite) Load(key string, val interface{}) error {
+	_, err := s.LoadETag(key, val)
+	return err
+}
+
+// LoadETag is Load, and also returns the ETag of key for use with
+// SaveETag.
+func (s *Sqlite) LoadETag(key string, val interface{}) (string, error) {
+	buf, err := s.LoadRaw(key)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Decode(buf, val); err != nil {
+		return "", decodeError(s.Path, key, err)
+	}
+	if ro, ok := val.(ReadOnlySetter); ok {
+		ro.SetReadOnly(s.ReadOnly())
+	}
+	if bb, ok := val.(BundleSetter); ok {
+		n := s.Name()
+		if n != "" {
+			bb.SetBundle(n)
+		}
+	}
+	return valueETag(buf), nil
+}
+
+func (s *Sqlite) SaveRaw(key string, buf []byte) error {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return UnWritable(key)
+	}
+	return s.saveRaw(s.q, key, buf)
+}
+
+func (s *Sqlite) saveRaw(q sqlQuerier, key string, buf []byte) error {
+	var val interface{} = buf
+	if utf8.Valid(buf) {
+		val = string(buf)
+	}
+	_, err := q.Exec(`INSERT OR REPLACE INTO store_values (prefix, key, value) VALUES (?, ?, ?)`,
+		s.Prefix, key, val)
+	return err
+}
+
+// SaveETag saves val as key only if the ETag of key is still etag,
+// which is usually the ETag returned by LoadETag.  An empty etag means
+// that key must not exist yet.  The check and the save happen in one
+// transaction.  It returns the new ETag of key, or StaleRevision if key
+// was changed in the meantime.
+func (s *Sqlite) SaveETag(key string, val interface{}, etag string) (string, error) {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return "", UnWritable(key)
+	}
+	buf, err := s.Encode(val)
+	if err != nil {
+		return "", err
+	}
+	err = s.inTx(func(q sqlQuerier) error {
+		var cur []byte
+		err := q.QueryRow(`SELECT value FROM store_values WHERE prefix = ? AND key = ?`, s.Prefix, key).Scan(&cur)
+		switch {
+		case err == sql.ErrNoRows:
+			if etag != "" {
+				return StaleRevision(key)
+			}
+		case err != nil:
+			return err
+		case valueETag(cur) != etag:
+			return StaleRevision(key)
+		}
+		return s.saveRaw(q, key, buf)
+	})
+	if err != nil {
+		return "", err
+	}
+	return valueETag(buf), nil
+}
+
+func (s *Sqlite) Save(key string, val interface{}) error {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return UnWritable(key)
+	}
+	buf, err := s.Encode(val)
+	if err != nil {
+		return err
+	}
+	return s.SaveRaw(key, buf)
+}
+
+// SaveStream reads all of r into memory and saves it as key.
+func (s *Sqlite) SaveStream(key string, r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return s.SaveRaw(key, buf)
+}
+
+func (s *Sqlite) LoadStream(key string) (io.ReadCloser, error) {
+	buf, err := s.LoadRaw(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(buf)), nil
+}
+
+func (s *Sqlite) Remove(key string) error {
+	s.panicIfClosed()
+	if s.ReadOnly() {
+		return UnWritable(key)
+	}
+	res, err := s.q.Exec(`DELETE FROM store_values WHERE prefix = ? AND key = ?`, s.Prefix, key)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return os.ErrNotExist
+	}
+	return nil
+}
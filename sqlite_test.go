@@ -0,0 +1,109 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestSqliteStore(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	loc := "sqlite:" + path.Join(tmpDir, "store.db")
+	s, err := Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to open sqlite store: %v", err)
+	}
+	db := s.(*Sqlite)
+	for _, val := range []*TestVal{
+		{Name: "machine-1", Val: "linux"},
+		{Name: "machine-2", Val: "windows"},
+		{Name: "profile-1", Val: "linux"},
+		{Name: "naïve-1", Val: "plan9"},
+	} {
+		if ok, err := Create(s, val); !ok {
+			t.Fatalf("Failed to create %s: %v", val.Name, err)
+		}
+	}
+	if keys, err := db.KeysWithPrefix("machine-"); err != nil || strings.Join(keys, ",") != "machine-1,machine-2" {
+		t.Errorf("Unexpected prefix listing: %v, %v", keys, err)
+	}
+	if keys, err := db.KeysWithPrefix("naï"); err != nil || strings.Join(keys, ",") != "naïve-1" {
+		t.Errorf("Unexpected non-ASCII prefix listing: %v, %v", keys, err)
+	}
+	db.Remove("naïve-1")
+	if keys, err := db.Query("Val", "linux"); err != nil || strings.Join(keys, ",") != "machine-1,profile-1" {
+		t.Errorf("Unexpected query result: %v, %v", keys, err)
+	}
+
+	boom := errors.New("boom")
+	err = db.Transaction(func(tx *Sqlite) error {
+		if err := tx.Save("machine-3", &TestVal{Name: "machine-3"}); err != nil {
+			return err
+		}
+		if err := tx.Remove("machine-1"); err != nil {
+			return err
+		}
+		return boom
+	})
+	if err != boom {
+		t.Errorf("Expected the transaction error, got %v", err)
+	}
+	if keys, _ := s.Keys(); len(keys) != 3 || keys[0] != "machine-1" {
+		t.Errorf("Transaction was not rolled back: %v", keys)
+	}
+	err = db.Transaction(func(tx *Sqlite) error {
+		sub, err := tx.MakeSub("archive")
+		if err != nil {
+			return err
+		}
+		if err := sub.Save("machine-1", &TestVal{Name: "machine-1"}); err != nil {
+			return err
+		}
+		return tx.Remove("machine-1")
+	})
+	if err != nil {
+		t.Errorf("Transaction failed: %v", err)
+	}
+	if keys, _ := s.Keys(); len(keys) != 2 {
+		t.Errorf("Expected machine-1 to be moved, got %v", keys)
+	}
+	sub := s.GetSub("archive")
+	if sub == nil {
+		t.Fatalf("Substore made in a transaction was not opened")
+	}
+	if keys, _ := sub.Keys(); len(keys) != 1 || keys[0] != "machine-1" {
+		t.Errorf("Unexpected substore keys: %v", keys)
+	}
+	err = db.Transaction(func(tx *Sqlite) error {
+		archive := tx.GetSub("archive")
+		if archive == nil {
+			return errors.New("Expected existing substores in the transaction")
+		}
+		_, err := archive.MakeSub("old")
+		return err
+	})
+	if err != nil {
+		t.Errorf("Transaction failed: %v", err)
+	}
+	if sub.GetSub("old") == nil {
+		t.Errorf("Substore made in an existing substore was not opened")
+	}
+	s.Close()
+
+	// A second handle sees the committed transactions.
+	s, err = Open(loc)
+	if err != nil {
+		t.Fatalf("Failed to reopen sqlite store: %v", err)
+	}
+	if s.GetSub("archive") == nil || s.GetSub("archive").GetSub("old") == nil {
+		t.Errorf("Substores made in transactions were not persisted")
+	}
+	s.Close()
+}
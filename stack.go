@@ -260,9 +260,21 @@ func (s StackCannotBeOverridden) Error() string {
 	return string(s)
 }
 
-func (s *StackedStore) Save(key string, val interface{}) error {
+// LoadRaw loads the raw bytes of key from the layer that holds it,
+// which are encoded with that layer's Codec.  If the layer is not a
+// RawStore, the value is loaded and encoded again with its Codec.
+func (s *StackedStore) LoadRaw(key string) ([]byte, error) {
 	s.RLock()
 	defer s.RUnlock()
+	idx, ok := s.keys[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	buf, _, err := encodedValue(s.stores[idx], key)
+	return buf, err
+}
+
+func (s *StackedStore) checkSave(key string) error {
 	idx, ok := s.keys[key]
 	if ok && idx != 0 {
 		// Key already exists.  Can it be overridden?
@@ -273,6 +285,15 @@ func (s *StackedStore) Save(key string, val interface{}) error {
 			return StackCannotOverride(key)
 		}
 	}
+	return nil
+}
+
+func (s *StackedStore) Save(key string, val interface{}) error {
+	s.RLock()
+	defer s.RUnlock()
+	if err := s.checkSave(key); err != nil {
+		return err
+	}
 	err := s.stores[0].Save(key, val)
 	if err == nil {
 		s.keys[key] = 0
@@ -280,6 +301,30 @@ func (s *StackedStore) Save(key string, val interface{}) error {
 	return err
 }
 
+// SaveRaw saves buf to the top layer of the stack, so buf must be
+// encoded with the top layer's Codec.  If the top layer is not a
+// RawStore, buf is decoded with its Codec and saved.
+func (s *StackedStore) SaveRaw(key string, buf []byte) error {
+	s.RLock()
+	defer s.RUnlock()
+	if err := s.checkSave(key); err != nil {
+		return err
+	}
+	var err error
+	if rs, ok := s.stores[0].(RawStore); ok {
+		err = rs.SaveRaw(key, buf)
+	} else {
+		var val interface{}
+		if val, err = decodeAny(cacheCodec(s.stores[0]), buf); err == nil {
+			err = s.stores[0].Save(key, val)
+		}
+	}
+	if err == nil {
+		s.keys[key] = 0
+	}
+	return err
+}
+
 func (s *StackedStore) Remove(key string) error {
 	s.RLock()
 	defer s.RUnlock()
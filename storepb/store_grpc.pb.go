@@ -0,0 +1,482 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             v4.25.3
+// source: store.proto
+
+// Package storepb defines a gRPC service that serves a Store.
+
+package storepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	Store_Info_FullMethodName        = "/digitalrebar.store.Store/Info"
+	Store_Keys_FullMethodName        = "/digitalrebar.store.Store/Keys"
+	Store_Load_FullMethodName        = "/digitalrebar.store.Store/Load"
+	Store_Save_FullMethodName        = "/digitalrebar.store.Store/Save"
+	Store_Remove_FullMethodName      = "/digitalrebar.store.Store/Remove"
+	Store_Subs_FullMethodName        = "/digitalrebar.store.Store/Subs"
+	Store_MakeSub_FullMethodName     = "/digitalrebar.store.Store/MakeSub"
+	Store_MetaData_FullMethodName    = "/digitalrebar.store.Store/MetaData"
+	Store_SetMetaData_FullMethodName = "/digitalrebar.store.Store/SetMetaData"
+	Store_Watch_FullMethodName       = "/digitalrebar.store.Store/Watch"
+)
+
+// StoreClient is the client API for Store service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type StoreClient interface {
+	// Info returns the name and type of a Store, and whether it is
+	// read-only.
+	Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error)
+	Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error)
+	Load(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (*LoadResponse, error)
+	Save(ctx context.Context, in *SaveRequest, opts ...grpc.CallOption) (*SaveResponse, error)
+	Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error)
+	// Subs returns the names of the substores of a Store.
+	Subs(ctx context.Context, in *SubsRequest, opts ...grpc.CallOption) (*SubsResponse, error)
+	MakeSub(ctx context.Context, in *MakeSubRequest, opts ...grpc.CallOption) (*MakeSubResponse, error)
+	// MetaData and SetMetaData always refer to the top-level Store.
+	MetaData(ctx context.Context, in *MetaDataRequest, opts ...grpc.CallOption) (*MetaDataResponse, error)
+	SetMetaData(ctx context.Context, in *SetMetaDataRequest, opts ...grpc.CallOption) (*SetMetaDataResponse, error)
+	// Watch streams the changes made to a Store until it is cancelled.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Store_WatchClient, error)
+}
+
+type storeClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewStoreClient(cc grpc.ClientConnInterface) StoreClient {
+	return &storeClient{cc}
+}
+
+func (c *storeClient) Info(ctx context.Context, in *InfoRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	out := new(InfoResponse)
+	err := c.cc.Invoke(ctx, Store_Info_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Keys(ctx context.Context, in *KeysRequest, opts ...grpc.CallOption) (*KeysResponse, error) {
+	out := new(KeysResponse)
+	err := c.cc.Invoke(ctx, Store_Keys_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Load(ctx context.Context, in *LoadRequest, opts ...grpc.CallOption) (*LoadResponse, error) {
+	out := new(LoadResponse)
+	err := c.cc.Invoke(ctx, Store_Load_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Save(ctx context.Context, in *SaveRequest, opts ...grpc.CallOption) (*SaveResponse, error) {
+	out := new(SaveResponse)
+	err := c.cc.Invoke(ctx, Store_Save_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Remove(ctx context.Context, in *RemoveRequest, opts ...grpc.CallOption) (*RemoveResponse, error) {
+	out := new(RemoveResponse)
+	err := c.cc.Invoke(ctx, Store_Remove_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Subs(ctx context.Context, in *SubsRequest, opts ...grpc.CallOption) (*SubsResponse, error) {
+	out := new(SubsResponse)
+	err := c.cc.Invoke(ctx, Store_Subs_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) MakeSub(ctx context.Context, in *MakeSubRequest, opts ...grpc.CallOption) (*MakeSubResponse, error) {
+	out := new(MakeSubResponse)
+	err := c.cc.Invoke(ctx, Store_MakeSub_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) MetaData(ctx context.Context, in *MetaDataRequest, opts ...grpc.CallOption) (*MetaDataResponse, error) {
+	out := new(MetaDataResponse)
+	err := c.cc.Invoke(ctx, Store_MetaData_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) SetMetaData(ctx context.Context, in *SetMetaDataRequest, opts ...grpc.CallOption) (*SetMetaDataResponse, error) {
+	out := new(SetMetaDataResponse)
+	err := c.cc.Invoke(ctx, Store_SetMetaData_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *storeClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (Store_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &Store_ServiceDesc.Streams[0], Store_Watch_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &storeWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type Store_WatchClient interface {
+	Recv() (*WatchEvent, error)
+	grpc.ClientStream
+}
+
+type storeWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *storeWatchClient) Recv() (*WatchEvent, error) {
+	m := new(WatchEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// StoreServer is the server API for Store service.
+// All implementations must embed UnimplementedStoreServer
+// for forward compatibility
+type StoreServer interface {
+	// Info returns the name and type of a Store, and whether it is
+	// read-only.
+	Info(context.Context, *InfoRequest) (*InfoResponse, error)
+	Keys(context.Context, *KeysRequest) (*KeysResponse, error)
+	Load(context.Context, *LoadRequest) (*LoadResponse, error)
+	Save(context.Context, *SaveRequest) (*SaveResponse, error)
+	Remove(context.Context, *RemoveRequest) (*RemoveResponse, error)
+	// Subs returns the names of the substores of a Store.
+	Subs(context.Context, *SubsRequest) (*SubsResponse, error)
+	MakeSub(context.Context, *MakeSubRequest) (*MakeSubResponse, error)
+	// MetaData and SetMetaData always refer to the top-level Store.
+	MetaData(context.Context, *MetaDataRequest) (*MetaDataResponse, error)
+	SetMetaData(context.Context, *SetMetaDataRequest) (*SetMetaDataResponse, error)
+	// Watch streams the changes made to a Store until it is cancelled.
+	Watch(*WatchRequest, Store_WatchServer) error
+	mustEmbedUnimplementedStoreServer()
+}
+
+// UnimplementedStoreServer must be embedded to have forward compatible implementations.
+type UnimplementedStoreServer struct {
+}
+
+func (UnimplementedStoreServer) Info(context.Context, *InfoRequest) (*InfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
+func (UnimplementedStoreServer) Keys(context.Context, *KeysRequest) (*KeysResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Keys not implemented")
+}
+func (UnimplementedStoreServer) Load(context.Context, *LoadRequest) (*LoadResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Load not implemented")
+}
+func (UnimplementedStoreServer) Save(context.Context, *SaveRequest) (*SaveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Save not implemented")
+}
+func (UnimplementedStoreServer) Remove(context.Context, *RemoveRequest) (*RemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedStoreServer) Subs(context.Context, *SubsRequest) (*SubsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Subs not implemented")
+}
+func (UnimplementedStoreServer) MakeSub(context.Context, *MakeSubRequest) (*MakeSubResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MakeSub not implemented")
+}
+func (UnimplementedStoreServer) MetaData(context.Context, *MetaDataRequest) (*MetaDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MetaData not implemented")
+}
+func (UnimplementedStoreServer) SetMetaData(context.Context, *SetMetaDataRequest) (*SetMetaDataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetMetaData not implemented")
+}
+func (UnimplementedStoreServer) Watch(*WatchRequest, Store_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (UnimplementedStoreServer) mustEmbedUnimplementedStoreServer() {}
+
+// UnsafeStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to StoreServer will
+// result in compilation errors.
+type UnsafeStoreServer interface {
+	mustEmbedUnimplementedStoreServer()
+}
+
+func RegisterStoreServer(s grpc.ServiceRegistrar, srv StoreServer) {
+	s.RegisterService(&Store_ServiceDesc, srv)
+}
+
+func _Store_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(InfoRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Info_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Info(ctx, req.(*InfoRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Keys_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeysRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Keys(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Keys_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Keys(ctx, req.(*KeysRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Load_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LoadRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Load(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Load_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Load(ctx, req.(*LoadRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Save_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SaveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Save(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Save_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Save(ctx, req.(*SaveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Remove(ctx, req.(*RemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Subs_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SubsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).Subs(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_Subs_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).Subs(ctx, req.(*SubsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_MakeSub_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MakeSubRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).MakeSub(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_MakeSub_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).MakeSub(ctx, req.(*MakeSubRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_MetaData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MetaDataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).MetaData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_MetaData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).MetaData(ctx, req.(*MetaDataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_SetMetaData_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetMetaDataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(StoreServer).SetMetaData(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Store_SetMetaData_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(StoreServer).SetMetaData(ctx, req.(*SetMetaDataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Store_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(StoreServer).Watch(m, &storeWatchServer{stream})
+}
+
+type Store_WatchServer interface {
+	Send(*WatchEvent) error
+	grpc.ServerStream
+}
+
+type storeWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *storeWatchServer) Send(m *WatchEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// Store_ServiceDesc is the grpc.ServiceDesc for Store service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Store_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "digitalrebar.store.Store",
+	HandlerType: (*StoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Info",
+			Handler:    _Store_Info_Handler,
+		},
+		{
+			MethodName: "Keys",
+			Handler:    _Store_Keys_Handler,
+		},
+		{
+			MethodName: "Load",
+			Handler:    _Store_Load_Handler,
+		},
+		{
+			MethodName: "Save",
+			Handler:    _Store_Save_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _Store_Remove_Handler,
+		},
+		{
+			MethodName: "Subs",
+			Handler:    _Store_Subs_Handler,
+		},
+		{
+			MethodName: "MakeSub",
+			Handler:    _Store_MakeSub_Handler,
+		},
+		{
+			MethodName: "MetaData",
+			Handler:    _Store_MetaData_Handler,
+		},
+		{
+			MethodName: "SetMetaData",
+			Handler:    _Store_SetMetaData_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _Store_Watch_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "store.proto",
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+type failingReader struct {
+	r io.Reader
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, errors.New("connection reset")
+	}
+	return n, err
+}
+
+func TestStreamStores(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	blob := bytes.Repeat([]byte("0123456789abcdef"), 256*1024)
+	for _, loc := range []string{
+		"memory:",
+		"directory:" + path.Join(tmpDir, "dir"),
+		"bolt:" + path.Join(tmpDir, "bolt"),
+	} {
+		s, err := Open(loc)
+		if err != nil {
+			t.Fatalf("%s: Failed to open: %v", loc, err)
+		}
+		ss, ok := s.(StreamStore)
+		if !ok {
+			t.Errorf("%s: Store is not a StreamStore", loc)
+			continue
+		}
+		if err := ss.SaveStream("blob", bytes.NewReader(blob)); err != nil {
+			t.Errorf("%s: Failed to save stream: %v", loc, err)
+		}
+		if err := ss.SaveStream("blob", &failingReader{bytes.NewReader([]byte("partial"))}); err == nil {
+			t.Errorf("%s: Expected a failing stream to fail to save", loc)
+		}
+		r, err := ss.LoadStream("blob")
+		if err != nil {
+			t.Errorf("%s: Failed to load stream: %v", loc, err)
+			continue
+		}
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil || !bytes.Equal(buf, blob) {
+			t.Errorf("%s: Streamed value changed: %v, %d bytes", loc, err, len(buf))
+		}
+		if _, err := ss.LoadStream("missing"); !os.IsNotExist(err) {
+			t.Errorf("%s: Expected loading a missing stream to fail, got %v", loc, err)
+		}
+		if keys, _ := s.Keys(); len(keys) != 1 {
+			t.Errorf("%s: Expected only the blob key, got %v", loc, keys)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,235 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/ghodss/yaml"
+	"github.com/pelletier/go-toml/v2"
+	"github.com/vmihailenco/msgpack/v5"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// DecodeError is the error returned when a strict Codec rejects a
+// value.  Stores fill in Path and Key when they return it from Load.
+type DecodeError struct {
+	// Path is where the Store keeps the value, if it has one.
+	Path string
+	// Key is the key the value was loaded from.
+	Key string
+	// Field is the name of the unknown field, if that is what the
+	// value was rejected for.
+	Field string
+	Err   error
+}
+
+func (d *DecodeError) Error() string {
+	msg := &strings.Builder{}
+	if d.Path != "" {
+		fmt.Fprintf(msg, "%s: ", d.Path)
+	}
+	if d.Key != "" {
+		fmt.Fprintf(msg, "key %s: ", d.Key)
+	}
+	if d.Field != "" {
+		fmt.Fprintf(msg, "unknown field %s: ", d.Field)
+	}
+	msg.WriteString(d.Err.Error())
+	return msg.String()
+}
+
+func (d *DecodeError) Unwrap() error {
+	return d.Err
+}
+
+// decodeError fills in the Path and Key of err if it is a
+// DecodeError.
+func decodeError(path, key string, err error) error {
+	if de, ok := err.(*DecodeError); ok {
+		res := *de
+		res.Path, res.Key = path, key
+		return &res
+	}
+	return err
+}
+
+// strictDecoder is implemented by Codecs that can decode a value
+// while rejecting unknown fields and trailing data.
+type strictDecoder interface {
+	decodeStrict([]byte, interface{}) error
+}
+
+func decodeStrict(c Codec, buf []byte, i interface{}) error {
+	sd, ok := c.(strictDecoder)
+	if !ok {
+		return fmt.Errorf("Codec %T does not support strict decoding", c)
+	}
+	return sd.decodeStrict(buf, i)
+}
+
+var errTrailing = errors.New("trailing data after value")
+
+func jsonStrict(buf []byte, i interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(i); err != nil {
+		const unknown = "json: unknown field "
+		if msg := err.Error(); strings.HasPrefix(msg, unknown) {
+			return &DecodeError{Field: strings.Trim(strings.TrimPrefix(msg, unknown), `"`), Err: err}
+		}
+		return &DecodeError{Err: err}
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &DecodeError{Err: errTrailing}
+	}
+	return nil
+}
+
+// yamlStrict decodes buf just as YamlCodec does, converting YAML
+// numbers and booleans to suit the fields they are decoded into, but
+// rejects unknown fields and any YAML documents after the first.
+func yamlStrict(buf []byte, i interface{}) error {
+	if err := yaml.Unmarshal(buf, i, yaml.DisallowUnknownFields); err != nil {
+		const unknown = "json: unknown field "
+		msg := err.Error()
+		if idx := strings.Index(msg, unknown); idx >= 0 {
+			return &DecodeError{Field: strings.Trim(msg[idx+len(unknown):], `"`), Err: err}
+		}
+		return &DecodeError{Err: err}
+	}
+	// yaml.Unmarshal only looks at the first document.
+	dec := yaml3.NewDecoder(bytes.NewReader(buf))
+	var doc yaml3.Node
+	if dec.Decode(&doc) == nil {
+		if err := dec.Decode(&doc); err != io.EOF {
+			return &DecodeError{Err: errTrailing}
+		}
+	}
+	return nil
+}
+
+func (y *yamlV3Codec) decodeStrict(buf []byte, i interface{}) error {
+	dec := yaml3.NewDecoder(bytes.NewReader(buf))
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return &DecodeError{Err: err}
+	}
+	var extra interface{}
+	if err := dec.Decode(&extra); err != io.EOF {
+		return &DecodeError{Err: errTrailing}
+	}
+	j, err := json.Marshal(stringKeys(val))
+	if err != nil {
+		return &DecodeError{Err: err}
+	}
+	return jsonStrict(j, i)
+}
+
+var cborStrictMode, _ = cbor.DecOptions{
+	DefaultMapType:    cborDecMode.DecOptions().DefaultMapType,
+	ExtraReturnErrors: cbor.ExtraDecErrorUnknownField,
+}.DecMode()
+
+// cborStrict cannot name unknown fields, as the CBOR decoder only
+// reports their position.
+func cborStrict(buf []byte, i interface{}) error {
+	if err := cborStrictMode.Unmarshal(buf, i); err != nil {
+		return &DecodeError{Err: err}
+	}
+	return nil
+}
+
+func msgpackStrict(buf []byte, i interface{}) error {
+	r := bytes.NewReader(buf)
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	dec.DisallowUnknownFields(true)
+	if err := dec.Decode(i); err != nil {
+		const unknown = "msgpack: unknown field "
+		if msg := err.Error(); strings.HasPrefix(msg, unknown) {
+			return &DecodeError{Field: strings.Trim(strings.TrimPrefix(msg, unknown), `"`), Err: err}
+		}
+		return &DecodeError{Err: err}
+	}
+	if r.Len() > 0 {
+		return &DecodeError{Err: errTrailing}
+	}
+	return nil
+}
+
+func tomlStrict(buf []byte, i interface{}) error {
+	dec := toml.NewDecoder(bytes.NewReader(buf))
+	dec.DisallowUnknownFields()
+	err := dec.Decode(i)
+	if err == nil {
+		return nil
+	}
+	res := &DecodeError{Err: err}
+	if sme, ok := err.(*toml.StrictMissingError); ok && len(sme.Errors) > 0 {
+		res.Field = strings.Join(sme.Errors[0].Key(), ".")
+	}
+	return res
+}
+
+type strictCodec struct {
+	inner Codec
+}
+
+// StrictCodec returns a Codec that decodes values with inner, but
+// rejects values with fields the target struct does not have and
+// values followed by trailing data.  Errors are returned as a
+// *DecodeError, which names the unknown field when it can.  inner can
+// be any of the built-in Codecs other than GobCodec, optionally
+// wrapped by CompressingCodec or EncryptingCodec.  Values are encoded
+// by inner unchanged.
+func StrictCodec(inner Codec) Codec {
+	return &strictCodec{inner: inner}
+}
+
+func (s *strictCodec) Encode(i interface{}) ([]byte, error) {
+	return s.inner.Encode(i)
+}
+
+func (s *strictCodec) Decode(buf []byte, i interface{}) error {
+	return decodeStrict(s.inner, buf, i)
+}
+
+func (s *strictCodec) Ext() string {
+	return s.inner.Ext()
+}
+
+func (s *strictCodec) viaJson() bool {
+	return isJsonBased(s.inner)
+}
+
+func (s *strictCodec) decodeStrict(buf []byte, i interface{}) error {
+	return s.Decode(buf, i)
+}
+
+func (c *codec) decodeStrict(buf []byte, i interface{}) error {
+	if c.strict == nil {
+		return fmt.Errorf("Codec with extension %s does not support strict decoding", c.ext)
+	}
+	return c.strict(buf, i)
+}
+
+func (c *compressingCodec) decodeStrict(buf []byte, i interface{}) error {
+	plain, err := c.decompress(buf)
+	if err != nil {
+		return err
+	}
+	return decodeStrict(c.inner, plain, i)
+}
+
+func (e *encryptingCodec) decodeStrict(buf []byte, i interface{}) error {
+	plain, err := e.decrypt(buf)
+	if err != nil {
+		return err
+	}
+	return decodeStrict(e.inner, plain, i)
+}
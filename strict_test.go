@@ -0,0 +1,91 @@
+package store
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestStrictCodec(t *testing.T) {
+	for _, codec := range []string{"json", "yaml", "yamlv3", "canonical", "cbor", "msgpack", "toml", "json+gzip"} {
+		s, err := Open("memory:?strict=true&codec=" + codec)
+		if err != nil {
+			t.Fatalf("%s: Failed to open strict store: %v", codec, err)
+		}
+		if err := s.Save("good", map[string]interface{}{"Name": "good", "Val": "v"}); err != nil {
+			t.Fatalf("%s: Failed to save: %v", codec, err)
+		}
+		if err := s.Save("typo", map[string]interface{}{"Name": "typo", "Vla": "v"}); err != nil {
+			t.Fatalf("%s: Failed to save: %v", codec, err)
+		}
+		if err := s.Load("good", &TestVal{}); err != nil {
+			t.Errorf("%s: Failed to load a valid value: %v", codec, err)
+		}
+		err = s.Load("typo", &TestVal{})
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: Expected a DecodeError, got %v", codec, err)
+			continue
+		}
+		if de.Key != "typo" {
+			t.Errorf("%s: Expected the error to name key typo, got %v", codec, err)
+		}
+		if codec != "cbor" && de.Field != "Vla" {
+			t.Errorf("%s: Expected the error to name field Vla, got %v", codec, err)
+		}
+	}
+}
+
+func TestStrictDirectory(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	sub := path.Join(tmpDir, "TestVal")
+	os.MkdirAll(sub, 0755)
+	ioutil.WriteFile(path.Join(sub, "a.yaml"), []byte("Name: a\nVal: ok\n"), 0644)
+	ioutil.WriteFile(path.Join(sub, "b.yaml"), []byte("Name: b\nVla: typo\n"), 0644)
+	ioutil.WriteFile(path.Join(sub, "c.json"), []byte(`{"Name":"c"} {"Name":"d"}`), 0644)
+
+	lax, _ := Open("directory:" + tmpDir + "?codec=yaml")
+	if _, err := List(lax.GetSub("TestVal"), &TestVal{}); err != nil {
+		t.Errorf("Expected a lax store to ignore unknown fields: %v", err)
+	}
+	s, err := Open("directory:" + tmpDir + "?codec=yaml&strict=true")
+	if err != nil {
+		t.Fatalf("Failed to open strict store: %v", err)
+	}
+	if _, err := List(s.GetSub("TestVal"), &TestVal{}); err == nil {
+		t.Errorf("Expected List to fail on an unknown field")
+	} else if msg := err.Error(); !strings.Contains(msg, "b.yaml") || !strings.Contains(msg, "Vla") {
+		t.Errorf("Expected the error to name the file and field, got %v", err)
+	}
+	if ok, err := Load(s.GetSub("TestVal"), &TestVal{Name: "a"}); !ok {
+		t.Errorf("Failed to load a valid value: %v", err)
+	}
+
+	js, _ := Open("directory:" + tmpDir + "?strict=true")
+	if err := js.GetSub("TestVal").Load("c", &TestVal{}); err == nil {
+		t.Errorf("Expected trailing data to be rejected")
+	}
+}
+
+func TestStrictYAMLMatchesLax(t *testing.T) {
+	strict := StrictCodec(YamlCodec)
+	val := &TestVal{}
+	if err := strict.Decode([]byte("Name: 42\nVal: true\n"), val); err != nil || val.Name != "42" || val.Val != "true" {
+		t.Errorf("Expected strict YAML to accept what lax YAML does, got %v, %v", val, err)
+	}
+	if err := strict.Decode([]byte("Name: a\n---\nName: b\n"), val); err == nil {
+		t.Errorf("Expected a trailing YAML document to be rejected")
+	}
+	err := strict.Decode([]byte("Name: a\nVla: typo\n"), val)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Field != "Vla" {
+		t.Errorf("Expected the error to name field Vla, got %v", err)
+	}
+}
@@ -0,0 +1,233 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// mergingCodec is implemented by Codecs that can carry comments and
+// formatting over from an existing encoded value when encoding a new
+// version of it.
+type mergingCodec interface {
+	Codec
+	EncodeOver(old []byte, i interface{}) ([]byte, error)
+}
+
+type yamlV3Codec struct{}
+
+// YamlV3Codec implements a Codec for encoding/decoding to YAML using
+// gopkg.in/yaml.v3.  Like YamlCodec, objects are converted through
+// JSON, so struct fields are named by their json tags and existing
+// YAML content can be read by either Codec.
+//
+// Unlike YamlCodec, anchors, aliases, and merge keys are resolved by
+// a real YAML parser, non-string map keys are turned into strings,
+// and multi-line strings are written as literal blocks.  When the
+// Directory and File stores overwrite an existing value, comments,
+// key order, scalar styles, and anchors and aliases for unchanged
+// values are carried over from what was there before, so annotations
+// made by hand survive being saved by tools.  Merge keys are expanded
+// when a value is saved.
+var YamlV3Codec Codec = &yamlV3Codec{}
+
+func (y *yamlV3Codec) Ext() string {
+	return ".yaml"
+}
+
+// stringKeys turns the map[interface{}]interface{} values yaml.v3
+// produces for maps with non-string keys into map[string]interface{}.
+func stringKeys(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(val))
+		for k, sub := range val {
+			res[fmt.Sprint(k)] = stringKeys(sub)
+		}
+		return res
+	case map[string]interface{}:
+		for k, sub := range val {
+			val[k] = stringKeys(sub)
+		}
+		return val
+	case []interface{}:
+		for i := range val {
+			val[i] = stringKeys(val[i])
+		}
+		return val
+	default:
+		return v
+	}
+}
+
+func (y *yamlV3Codec) viaJson() bool {
+	return true
+}
+
+func (y *yamlV3Codec) Decode(buf []byte, i interface{}) error {
+	var val interface{}
+	if err := yaml3.Unmarshal(buf, &val); err != nil {
+		return err
+	}
+	j, err := json.Marshal(stringKeys(val))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(j, i)
+}
+
+// plainStyles clears the JSON flow and quoting styles from n so that
+// it is written as block YAML.
+func plainStyles(n *yaml3.Node) {
+	n.Style = 0
+	for _, c := range n.Content {
+		plainStyles(c)
+	}
+}
+
+func (y *yamlV3Codec) node(i interface{}) (*yaml3.Node, error) {
+	j, err := json.Marshal(i)
+	if err != nil {
+		return nil, err
+	}
+	doc := &yaml3.Node{}
+	if err := yaml3.Unmarshal(j, doc); err != nil {
+		return nil, err
+	}
+	plainStyles(doc)
+	return doc, nil
+}
+
+func marshalNode(n *yaml3.Node) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := yaml3.NewEncoder(buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(n); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (y *yamlV3Codec) Encode(i interface{}) ([]byte, error) {
+	doc, err := y.node(i)
+	if err != nil {
+		return nil, err
+	}
+	return marshalNode(doc)
+}
+
+// EncodeOver encodes i, carrying over comments, key order, scalar
+// styles, and anchors and aliases from old wherever the values
+// match.
+func (y *yamlV3Codec) EncodeOver(old []byte, i interface{}) ([]byte, error) {
+	doc, err := y.node(i)
+	if err != nil {
+		return nil, err
+	}
+	oldDoc := &yaml3.Node{}
+	if err := yaml3.Unmarshal(old, oldDoc); err != nil || oldDoc.Kind != yaml3.DocumentNode {
+		return marshalNode(doc)
+	}
+	m := &nodeMerger{anchors: map[string]*yaml3.Node{}}
+	doc = m.merge(oldDoc, doc, false)
+	return marshalNode(doc)
+}
+
+type nodeMerger struct {
+	anchors map[string]*yaml3.Node
+}
+
+func sameValue(a, b *yaml3.Node) bool {
+	var av, bv interface{}
+	if a.Decode(&av) != nil || b.Decode(&bv) != nil {
+		return false
+	}
+	return reflect.DeepEqual(stringKeys(av), stringKeys(bv))
+}
+
+func (m *nodeMerger) merge(old, cur *yaml3.Node, isKey bool) *yaml3.Node {
+	if old.Kind == yaml3.AliasNode {
+		if target, ok := m.anchors[old.Value]; ok && sameValue(old.Alias, cur) {
+			return &yaml3.Node{
+				Kind:        yaml3.AliasNode,
+				Value:       old.Value,
+				Alias:       target,
+				HeadComment: old.HeadComment,
+				LineComment: old.LineComment,
+				FootComment: old.FootComment,
+			}
+		}
+		return m.merge(old.Alias, cur, isKey)
+	}
+	cur.HeadComment = old.HeadComment
+	cur.LineComment = old.LineComment
+	cur.FootComment = old.FootComment
+	if _, seen := m.anchors[old.Anchor]; old.Anchor != "" && !seen && sameValue(old, cur) {
+		cur.Anchor = old.Anchor
+		m.anchors[old.Anchor] = cur
+	}
+	if old.Kind != cur.Kind {
+		return cur
+	}
+	switch cur.Kind {
+	case yaml3.DocumentNode:
+		if len(old.Content) == 1 && len(cur.Content) == 1 {
+			cur.Content[0] = m.merge(old.Content[0], cur.Content[0], false)
+		}
+	case yaml3.SequenceNode:
+		cur.Style = old.Style
+		for i := range cur.Content {
+			if i < len(old.Content) {
+				cur.Content[i] = m.merge(old.Content[i], cur.Content[i], false)
+			}
+		}
+	case yaml3.MappingNode:
+		cur.Style = old.Style
+		m.mergeMapping(old, cur)
+	case yaml3.ScalarNode:
+		if old.Value == cur.Value {
+			cur.Style = old.Style
+			if isKey {
+				cur.Tag = old.Tag
+			}
+		}
+	}
+	return cur
+}
+
+// mergeMapping merges the key/value pairs of cur with those of old.
+// Keys that are in old keep their old order, and new keys follow.
+func (m *nodeMerger) mergeMapping(old, cur *yaml3.Node) {
+	curIdx := map[string]int{}
+	for i := 0; i+1 < len(cur.Content); i += 2 {
+		curIdx[cur.Content[i].Value] = i
+	}
+	used := map[int]bool{}
+	content := make([]*yaml3.Node, 0, len(cur.Content))
+	for i := 0; i+1 < len(old.Content); i += 2 {
+		j, ok := curIdx[old.Content[i].Value]
+		if !ok || used[j] {
+			continue
+		}
+		used[j] = true
+		content = append(content,
+			m.merge(old.Content[i], cur.Content[j], true),
+			m.merge(old.Content[i+1], cur.Content[j+1], false))
+	}
+	for i := 0; i+1 < len(cur.Content); i += 2 {
+		if !used[i] {
+			content = append(content, cur.Content[i], cur.Content[i+1])
+		}
+	}
+	cur.Content = content
+}
+
+func init() {
+	RegisterCodec("yamlv3", YamlV3Codec)
+}
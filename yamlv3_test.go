@@ -0,0 +1,78 @@
+package store
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+type yamlVal struct {
+	Name     string
+	Count    int
+	Script   string
+	Defaults map[string]string
+	Override map[string]string
+	Ports    map[string]string
+}
+
+const annotatedYaml = `# Operator notes for this object.
+Name: annotated
+Count: 1 # bump this carefully
+Script: |
+  #!/bin/sh
+  echo hello
+Defaults: &defaults
+  os: linux # the only supported OS
+Override: *defaults
+Ports:
+  80: http
+`
+
+func TestYamlV3Comments(t *testing.T) {
+	tmpDir, err := ioutil.TempDir("", "store-")
+	if err != nil {
+		t.Fatalf("Failed to create tmp dir: %v", err)
+	}
+	defer os.RemoveAll(tmpDir)
+	fileName := path.Join(tmpDir, "annotated.yaml")
+	if err := ioutil.WriteFile(fileName, []byte(annotatedYaml), 0644); err != nil {
+		t.Fatalf("Failed to write annotated object: %v", err)
+	}
+	s, err := Open("directory:" + tmpDir + "?codec=yamlv3")
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	val := &yamlVal{}
+	if err := s.Load("annotated", val); err != nil {
+		t.Fatalf("Failed to load annotated object: %v", err)
+	}
+	if val.Override["os"] != "linux" || val.Ports["80"] != "http" {
+		t.Errorf("Aliases or non-string keys were not decoded: %#v", val)
+	}
+	val.Count = 2
+	if err := s.Save("annotated", val); err != nil {
+		t.Fatalf("Failed to save annotated object: %v", err)
+	}
+	buf, _ := ioutil.ReadFile(fileName)
+	expected := strings.Replace(annotatedYaml, "Count: 1", "Count: 2", 1)
+	if string(buf) != expected {
+		t.Errorf("Annotations did not survive a save.  Expected:\n%s\nGot:\n%s", expected, string(buf))
+	}
+
+	fileStore := path.Join(tmpDir, "data.yaml")
+	doc := "# Top-level notes\nfoo: # about foo\n  Name: foo\n  Count: 1\n"
+	if err := ioutil.WriteFile(fileStore, []byte(doc), 0644); err != nil {
+		t.Fatalf("Failed to write file store: %v", err)
+	}
+	fs, err := Open("file:" + fileStore + "?codec=yamlv3")
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	fs.Save("bar", &struct{ Name string }{"bar"})
+	buf, _ = ioutil.ReadFile(fileStore)
+	if !strings.HasPrefix(string(buf), "# Top-level notes\nfoo: # about foo\n") {
+		t.Errorf("File store comments did not survive a save:\n%s", string(buf))
+	}
+}